@@ -11,6 +11,7 @@ import (
 	"github.com/EpiK-Protocol/go-epik-gateway/app/config"
 	"github.com/EpiK-Protocol/go-epik-gateway/service"
 	"github.com/EpiK-Protocol/go-epik-gateway/storage"
+	"github.com/EpiK-Protocol/go-epik-gateway/task"
 	"github.com/EpiK-Protocol/go-epik-gateway/utils"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -24,12 +25,14 @@ type App interface {
 	Log() *logrus.Logger
 	Storage() storage.Storage
 	Service() service.IService
+	Replayer() task.Replayer
 }
 
 type API struct {
-	conf    config.Config
-	storage storage.Storage
-	service service.IService
+	conf     config.Config
+	storage  storage.Storage
+	service  service.IService
+	replayer task.Replayer
 
 	engine *gin.Engine
 }
@@ -49,10 +52,11 @@ func NewAPI(app App) (*API, error) {
 		engine.Use(ginBodyLogMiddleware)
 	}
 	api := &API{
-		conf:    app.Config(),
-		storage: app.Storage(),
-		service: app.Service(),
-		engine:  engine,
+		conf:     app.Config(),
+		storage:  app.Storage(),
+		service:  app.Service(),
+		replayer: app.Replayer(),
+		engine:   engine,
 	}
 	return api, nil
 }
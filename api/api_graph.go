@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/EpiK-Protocol/go-epik-gateway/graph"
+	"github.com/EpiK-Protocol/go-epik-gateway/task"
 	"github.com/gin-gonic/gin"
 )
 
@@ -13,6 +15,8 @@ func (a *API) setGraphAPI() {
 	data := a.engine.Group("graph")
 	data.POST("query", a.GraphQuery)
 	data.POST("export", a.GraphExport)
+	data.GET("health", a.GraphHealth)
+	data.GET("schema/:space", a.GraphSchema)
 }
 
 func (a *API) GraphQuery(ctx *gin.Context) {
@@ -24,14 +28,14 @@ func (a *API) GraphQuery(ctx *gin.Context) {
 		return
 	}
 
-	sql := req.Sql
+	sql := task.ResolveQuery(req.Sql, a.replayer.ResolveSpace)
 	// sql := ctx.Param("sql")
 
 	// log.WithFields(logrus.Fields{
 	// 	"sql": sql,
 	// }).Debug("query")
 
-	data, err := a.service.Nebula().Query(sql)
+	data, err := a.service.Graph().Query(sql)
 	if err != nil {
 		responseJSON(ctx, serverError(err))
 		return
@@ -39,6 +43,32 @@ func (a *API) GraphQuery(ctx *gin.Context) {
 	responseJSON(ctx, errOK, "data", data)
 }
 
+func (a *API) GraphHealth(ctx *gin.Context) {
+	responseJSON(ctx, errOK, "data", a.service.Graph().Health())
+}
+
+// GraphSchema returns the registered schema of a space with its history and
+// drift from the live schema.
+func (a *API) GraphSchema(ctx *gin.Context) {
+	space := ctx.Param("space")
+	schema, history, err := a.replayer.Schema(space)
+	if task.IsNotFound(err) {
+		responseJSON(ctx, errNotfound)
+		return
+	}
+	if err != nil {
+		responseJSON(ctx, serverError(err))
+		return
+	}
+	drift, err := a.replayer.SchemaDrift(space)
+	if err != nil {
+		// the registry is still served while the live schema is unavailable.
+		responseJSON(ctx, errOK, "data", schema, "history", history, "drift_error", err.Error())
+		return
+	}
+	responseJSON(ctx, errOK, "data", schema, "history", history, "drift", drift)
+}
+
 func (a *API) GraphExport(ctx *gin.Context) {
 	req := &struct {
 		Space string `json:"space"`
@@ -55,99 +85,27 @@ func (a *API) GraphExport(ctx *gin.Context) {
 	// 	"sql": sql,
 	// }).Debug("query")
 
-	space := req.Space
-	tagSql := fmt.Sprintf("USE %s;SHOW TAGS;", space)
-
-	results, err := a.service.Nebula().Query(tagSql)
-	if err != nil {
-		responseJSON(ctx, serverError(err))
-		return
-	}
-
-	tags := []string{}
-	for _, rdata := range results {
-		for _, data := range rdata.Data {
-			for _, row := range data.Row {
-				tags = append(tags, row.(string))
-			}
-		}
-	}
-
-	ids := []string{}
-	for _, tag := range tags {
-		sql := fmt.Sprintf("USE %s;MATCH (v:%s) RETURN v;", space, tag)
-		results, err := a.service.Nebula().Query(sql)
-		if err != nil {
-			responseJSON(ctx, serverError(err))
-			return
-		}
-		for _, rdata := range results {
-			for _, data := range rdata.Data {
-				for _, dmeta := range data.Meta {
-					meta := dmeta.(map[string]interface{})
-					id := meta["id"].(string)
-					ids = append(ids, id)
-				}
-			}
-		}
-	}
-
-	// rdfs := []string{}
+	space := a.replayer.ResolveSpace(req.Space)
 	vertexs := []string{"id,attributes"}
 	edges := []string{"type,src,dst,rank,name,attributes"}
-	for _, vertex := range ids {
-		sql := fmt.Sprintf("USE %s;GET SUBGRAPH WITH PROP 1 STEPS FROM '%s';", space, vertex)
-		results, err := a.service.Nebula().Query(sql)
+	err := a.service.Graph().Export(space, func(vertex *graph.Vertex) error {
+		attribute, err := json.Marshal(vertex.Props)
 		if err != nil {
-			responseJSON(ctx, serverError(err))
-			return
+			return err
 		}
-		for _, rdata := range results {
-			for _, data := range rdata.Data {
-				for idx, dmeta := range data.Meta {
-					// fmt.Println("metaxxxxx:", dmeta)
-					ameta := dmeta.([]interface{})
-					for iidex, imeta := range ameta {
-						meta := imeta.(map[string]interface{})
-						mtype := meta["type"].(string)
-						if mtype == "vertex" {
-							id := meta["id"].(string)
-							irow := data.Row[idx].([]interface{})
-							drow := irow[iidex].(map[string]interface{})
-							attribute, err := json.Marshal(drow)
-							if err != nil {
-								responseJSON(ctx, serverError(err))
-								return
-							}
-							line := id + "," + string(attribute)
-							vertexs = append(vertexs, line)
-							// for key, val := range drow {
-							// 	line := id + "," + key + "," + val.(string)
-							// 	vertexs = append(vertexs, line)
-							// 	rdfs = append(rdfs, line)
-							// }
-						} else if mtype == "edge" {
-							id := meta["id"].(map[string]interface{})
-							types := id["type"].(float64)
-							src := id["src"].(string)
-							dst := id["dst"].(string)
-							name := id["name"].(string)
-							rank := id["ranking"].(float64)
-							irow := data.Row[idx].([]interface{})
-							drow := irow[iidex].(map[string]interface{})
-							attribute, err := json.Marshal(drow)
-							if err != nil {
-								responseJSON(ctx, serverError(err))
-								return
-							}
-							line := fmt.Sprintf("%.0f,%s,%s,%.0f,%s,%s", types, src, dst, rank, name, string(attribute))
-							edges = append(edges, line)
-							// rdfs = append(rdfs, line)
-						}
-					}
-				}
-			}
+		vertexs = append(vertexs, vertex.ID+","+string(attribute))
+		return nil
+	}, func(edge *graph.Edge) error {
+		attribute, err := json.Marshal(edge.Props)
+		if err != nil {
+			return err
 		}
+		edges = append(edges, fmt.Sprintf("%d,%s,%s,%d,%s,%s", edge.Type, edge.Src, edge.Dst, edge.Rank, edge.Name, string(attribute)))
+		return nil
+	})
+	if err != nil {
+		responseJSON(ctx, serverError(err))
+		return
 	}
 
 	vertexPath := fmt.Sprintf("%s/%s_vertex.csv", basePath, req.Space)
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"strconv"
+
+	"github.com/EpiK-Protocol/go-epik-gateway/task"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/xerrors"
+)
+
+func (a *API) setReplayAPI() {
+	data := a.engine.Group("replay")
+	data.GET("experts", a.ReplayExperts)
+	data.GET("experts/:expert", a.ReplayExpert)
+	data.POST("experts/:expert/advance", a.ReplayAdvance)
+	data.POST("experts/:expert/rebuild", a.ReplayRebuild)
+	data.GET("experts/:expert/reconcile", a.ReplayReconcile)
+	data.POST("experts/:expert/validate", a.ReplayValidate)
+	data.GET("spaces", a.ReplaySpaces)
+	data.POST("spaces/:space/rollback", a.ReplayRollback)
+}
+
+func (a *API) ReplayExperts(ctx *gin.Context) {
+	data, err := a.replayer.Experts()
+	if err != nil {
+		responseJSON(ctx, serverError(err))
+		return
+	}
+	responseJSON(ctx, errOK, "data", data)
+}
+
+func (a *API) ReplayExpert(ctx *gin.Context) {
+	data, err := a.replayer.Expert(ctx.Param("expert"))
+	if task.IsNotFound(err) {
+		responseJSON(ctx, errNotfound)
+		return
+	}
+	if err != nil {
+		responseJSON(ctx, serverError(err))
+		return
+	}
+	responseJSON(ctx, errOK, "data", data)
+}
+
+func (a *API) ReplayAdvance(ctx *gin.Context) {
+	req := &struct {
+		// file index to resume from, zero for the next one.
+		Index  int64  `json:"index"`
+		Reason string `json:"reason"`
+	}{}
+	if err := ctx.ShouldBindJSON(req); err != nil {
+		responseJSON(ctx, clientError(err))
+		return
+	}
+
+	data, err := a.replayer.Advance(ctx.Param("expert"), req.Index, req.Reason)
+	if task.IsNotFound(err) {
+		responseJSON(ctx, errNotfound)
+		return
+	}
+	if err != nil {
+		responseJSON(ctx, clientError(err))
+		return
+	}
+	responseJSON(ctx, errOK, "data", data)
+}
+
+func (a *API) ReplayRebuild(ctx *gin.Context) {
+	req := &struct {
+		// drop or keep the space.
+		Mode   string `json:"mode"`
+		DryRun bool   `json:"dry_run"`
+		// token of the dry run confirming the rebuild.
+		Token string `json:"token"`
+	}{}
+	if err := ctx.ShouldBindJSON(req); err != nil {
+		responseJSON(ctx, clientError(err))
+		return
+	}
+
+	data, err := a.replayer.Rebuild(ctx.Param("expert"), req.Mode, req.DryRun, req.Token)
+	if task.IsNotFound(err) {
+		responseJSON(ctx, errNotfound)
+		return
+	}
+	if xerrors.Is(err, task.ErrRebuildToken) {
+		responseJSON(ctx, clientError(err))
+		return
+	}
+	if err != nil {
+		responseJSON(ctx, serverError(err))
+		return
+	}
+	responseJSON(ctx, errOK, "data", data)
+}
+
+func (a *API) ReplayReconcile(ctx *gin.Context) {
+	data, err := a.replayer.Reconciliation(ctx.Param("expert"))
+	if task.IsNotFound(err) {
+		responseJSON(ctx, errNotfound)
+		return
+	}
+	if err != nil {
+		responseJSON(ctx, serverError(err))
+		return
+	}
+	responseJSON(ctx, errOK, "data", data)
+}
+
+// ReplayValidate checks the file in the request body, the report keeps the
+// generated nGQL with "ngql=true".
+func (a *API) ReplayValidate(ctx *gin.Context) {
+	ngql, _ := strconv.ParseBool(ctx.Query("ngql"))
+	data, err := a.replayer.Validate(ctx.Param("expert"), ctx.DefaultQuery("name", "upload"), ctx.Request.Body, ngql)
+	if err != nil {
+		responseJSON(ctx, serverError(err))
+		return
+	}
+	responseJSON(ctx, errOK, "data", data)
+}
+
+func (a *API) ReplaySpaces(ctx *gin.Context) {
+	data, err := a.replayer.Spaces()
+	if err != nil {
+		responseJSON(ctx, serverError(err))
+		return
+	}
+	responseJSON(ctx, errOK, "data", data)
+}
+
+func (a *API) ReplayRollback(ctx *gin.Context) {
+	req := &struct {
+		// kept nebula space to serve, the newest one when empty.
+		To string `json:"to"`
+	}{}
+	if err := ctx.ShouldBindJSON(req); err != nil {
+		responseJSON(ctx, clientError(err))
+		return
+	}
+
+	data, err := a.replayer.Rollback(ctx.Param("space"), req.To)
+	if task.IsNotFound(err) {
+		responseJSON(ctx, errNotfound)
+		return
+	}
+	if err != nil {
+		responseJSON(ctx, clientError(err))
+		return
+	}
+	responseJSON(ctx, errOK, "data", data)
+}
@@ -2,5 +2,6 @@ package api
 
 func (a *API) setupRouter() error {
 	a.setGraphAPI()
+	a.setReplayAPI()
 	return nil
 }
@@ -10,6 +10,7 @@ import (
 
 	"github.com/EpiK-Protocol/go-epik-gateway/api"
 	"github.com/EpiK-Protocol/go-epik-gateway/app/config"
+	"github.com/EpiK-Protocol/go-epik-gateway/graph"
 	"github.com/EpiK-Protocol/go-epik-gateway/service"
 	"github.com/EpiK-Protocol/go-epik-gateway/storage"
 	"github.com/EpiK-Protocol/go-epik-gateway/task"
@@ -38,6 +39,8 @@ type App struct {
 
 	eventBus EventBus.Bus
 
+	graph graph.GraphStore
+
 	api *api.API
 
 	task task.Task
@@ -64,7 +67,12 @@ func New(config config.Config) (*App, error) { // init random seed.
 
 	bus := EventBus.New()
 
-	task, err := task.NewTask(config, st, bus)
+	store, err := graph.NewStore(config)
+	if err != nil {
+		return nil, err
+	}
+
+	task, err := task.NewTask(config, st, bus, store)
 	if err != nil {
 		return nil, err
 	}
@@ -75,6 +83,7 @@ func New(config config.Config) (*App, error) { // init random seed.
 		log:      logging.Log(),
 		storage:  st,
 		eventBus: bus,
+		graph:    store,
 		task:     task,
 	}
 
@@ -113,6 +122,8 @@ func (a *App) Start() error {
 	}
 	a.running = true
 
+	a.graph.Start()
+
 	if err := a.task.Start(a.context); err != nil {
 		return err
 	}
@@ -140,6 +151,8 @@ func (a *App) Stop() error {
 		return err
 	}
 
+	a.graph.Close()
+
 	a.running = false
 
 	log.Info("Stopped App.")
@@ -161,7 +174,17 @@ func (n *App) Storage() storage.Storage {
 	return n.storage
 }
 
+// Graph returns the graph store reference.
+func (n *App) Graph() graph.GraphStore {
+	return n.graph
+}
+
 // Service returns service reference.
 func (n *App) Service() service.IService {
 	return n.service
 }
+
+// Replayer returns replay controls reference.
+func (n *App) Replayer() task.Replayer {
+	return n.task.Replayer()
+}
@@ -2,9 +2,12 @@ package config
 
 import (
 	"io/ioutil"
+	"time"
 
+	"github.com/EpiK-Protocol/go-epik-gateway/utils"
 	"github.com/EpiK-Protocol/go-epik-gateway/utils/logging"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
 	yaml "gopkg.in/yaml.v2"
 )
 
@@ -17,6 +20,10 @@ type Config struct {
 	Storage Storage `yaml:"storage"`
 	Chains  []Chain `yaml:"chains"`
 	Nebula  Nebula  `yaml:"nebula"`
+	Graph   Graph   `yaml:"graph"`
+
+	Transfer Transfer `yaml:"transfer"`
+	Replay   Replay   `yaml:"replay"`
 }
 
 type App struct {
@@ -39,11 +46,211 @@ type Server struct {
 
 	EnableDownload bool   `yaml:"enable_download"`
 	DownloadUrl    string `yaml:"download_url"`
+
+	HTTPClient HTTPClient `yaml:"http_client"`
+}
+
+type HTTPClient struct {
+	// proxy url, empty uses HTTP_PROXY/HTTPS_PROXY of environment.
+	Proxy string `yaml:"proxy"`
+
+	// pem files for server verification and client certificates.
+	CAFile             string `yaml:"ca_file"`
+	CertFile           string `yaml:"cert_file"`
+	KeyFile            string `yaml:"key_file"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+
+	// auth for the sequence api, not sent to file urls.
+	Headers     map[string]string `yaml:"headers"`
+	BearerToken string            `yaml:"bearer_token"`
+
+	DialTimeout           time.Duration `yaml:"dial_timeout"`
+	ResponseHeaderTimeout time.Duration `yaml:"response_header_timeout"`
+	// timeout of api requests, file downloads are not limited.
+	RequestTimeout time.Duration `yaml:"request_timeout"`
 }
 
 type Storage struct {
 	DBDir   string `yaml:"db_dir"`
 	DataDir string `yaml:"data_dir"`
+
+	// sizes in bytes, zero means unlimited.
+	MaxDataSize  int64 `yaml:"max_data_size"`
+	MinFreeSpace int64 `yaml:"min_free_space"`
+
+	// what to do with a file after it is replayed: keep, delete or compress.
+	ReplayedPolicy string `yaml:"replayed_policy"`
+
+	// keep downloaded files compressed on disk: gzip or zstd, empty for none.
+	Compression string `yaml:"compression"`
+}
+
+type Transfer struct {
+	// bytes per second, zero means unlimited.
+	RateLimit int64 `yaml:"rate_limit"`
+	// bytes per second keyed by source host.
+	SourceRateLimit map[string]int64 `yaml:"source_rate_limit"`
+
+	// local time windows allowing heavy transfers, eg: "22:00-06:00".
+	Windows []string `yaml:"windows"`
+}
+
+type Replay struct {
+	// insert statements sent to nebula in one execute.
+	BatchSize int `yaml:"batch_size"`
+	// experts replayed in parallel.
+	Workers int `yaml:"workers"`
+	// max wait for created schemas to be visible in nebula.
+	SchemaTimeout time.Duration `yaml:"schema_timeout"`
+	// max wait for index rebuild jobs submitted after a file is imported.
+	RebuildTimeout time.Duration `yaml:"rebuild_timeout"`
+	// indexes created along with tags and edges, the first matching rule applies.
+	Indexes []IndexRule `yaml:"indexes"`
+	// experts delivering structured data files, the gateway generates inserts.
+	Mappings map[string]Mapping `yaml:"mappings"`
+	// statement rewrites by expert applied before writing.
+	Transforms map[string]Transform `yaml:"transforms"`
+	// fail files with statements outside the replay policy instead of
+	// skipping them.
+	Strict bool `yaml:"strict"`
+	// lines pending at a crash which can't be executed twice: fail, retry or skip.
+	InDoubt string `yaml:"in_doubt"`
+	// missing file index followed by later ones: wait, skip or fail once
+	// GapWait passed.
+	GapPolicy string        `yaml:"gap_policy"`
+	GapWait   time.Duration `yaml:"gap_wait"`
+	// replaced nebula spaces of a shadow rebuild kept for rollback, zero
+	// drops the replaced space at cut-over.
+	KeepVersions int `yaml:"keep_versions"`
+	// compare the counts of imported files against nebula stats, a
+	// mismatched file is imported again up to ReimportAttempts times.
+	Reconcile        bool `yaml:"reconcile"`
+	ReimportAttempts int  `yaml:"reimport_attempts"`
+	// statements per second written into a nebula space, zero for unlimited.
+	RateLimit int `yaml:"rate_limit"`
+	// writes failing on overload or leader change are retried with a growing
+	// delay, so are slower writes than SlowWrite slowing the space down.
+	WriteRetries int           `yaml:"write_retries"`
+	SlowWrite    time.Duration `yaml:"slow_write"`
+	// first pause of the replay once graphd is unreachable, it doubles while
+	// graphd stays down.
+	BreakerPause time.Duration `yaml:"breaker_pause"`
+}
+
+const (
+	InDoubtFail  = "fail"
+	InDoubtRetry = "retry"
+	InDoubtSkip  = "skip"
+)
+
+const (
+	GapWait = "wait"
+	GapSkip = "skip"
+	GapFail = "fail"
+)
+
+// IndexRule selects the indexes of created tags and edges, empty match fields
+// match everything.
+type IndexRule struct {
+	Expert string `yaml:"expert"`
+	Space  string `yaml:"space"`
+	// tag or edge.
+	Schema string `yaml:"schema"`
+	// tag or edge name.
+	Name string `yaml:"name"`
+
+	// create no index.
+	Skip bool `yaml:"skip"`
+	// properties to index, one index per property.
+	Fields []IndexField `yaml:"fields"`
+	// create full-text indexes, requires an elasticsearch listener.
+	FullText bool `yaml:"full_text"`
+}
+
+type IndexField struct {
+	Name string `yaml:"name"`
+	// index length of string properties, zero for other types.
+	Length int `yaml:"length"`
+}
+
+const (
+	FormatCSV     = "csv"
+	FormatJSONL   = "jsonl"
+	FormatParquet = "parquet"
+)
+
+// Transform rewrites the statements of an expert, rules use the names of the
+// expert files and apply in the order of the fields.
+type Transform struct {
+	// properties dropped as "tag.prop", "edge.prop" or "prop" of all.
+	DropProps []string `yaml:"drop_props"`
+	// properties renamed by "tag.prop", "edge.prop" or "prop" of all.
+	RenameProps map[string]string `yaml:"rename_props"`
+	RenameTags  map[string]string `yaml:"rename_tags"`
+	RenameEdges map[string]string `yaml:"rename_edges"`
+	VID         VIDTransform      `yaml:"vid"`
+	// properties added to all tags and edges by name, valued by the source:
+	// expert, file, root_cid or index.
+	Provenance map[string]string `yaml:"provenance"`
+	// transforms registered by name in go, applied after the rules.
+	Custom []string `yaml:"custom"`
+}
+
+// VIDTransform rewrites string vertex ids, other ids are kept.
+type VIDTransform struct {
+	// md5, sha1 or sha256 hex of the id.
+	Hash string `yaml:"hash"`
+	// prepended after hashing.
+	Prefix string `yaml:"prefix"`
+}
+
+const (
+	ProvenanceExpert  = "expert"
+	ProvenanceFile    = "file"
+	ProvenanceRootCID = "root_cid"
+	ProvenanceIndex   = "index"
+)
+
+// Mapping describes how records of csv, jsonl or parquet files become
+// vertices and edges.
+type Mapping struct {
+	// csv, jsonl or parquet.
+	Format string `yaml:"format"`
+	// csv field delimiter, default ",".
+	Delimiter string `yaml:"delimiter"`
+	// vid type of the space, string or int, default string.
+	VIDType string `yaml:"vid_type"`
+	// create the mapped tags and edges if not exist.
+	CreateSchema bool `yaml:"create_schema"`
+
+	Vertices []VertexMapping `yaml:"vertices"`
+	Edges    []EdgeMapping   `yaml:"edges"`
+}
+
+type VertexMapping struct {
+	Tag string `yaml:"tag"`
+	// column of the vertex id, records without it are skipped.
+	VID   string        `yaml:"vid"`
+	Props []PropMapping `yaml:"props"`
+}
+
+type EdgeMapping struct {
+	Edge string `yaml:"edge"`
+	// columns of the source and destination vertex ids, records without them
+	// are skipped.
+	Src string `yaml:"src"`
+	Dst string `yaml:"dst"`
+	// optional column of the edge rank.
+	Rank  string        `yaml:"rank"`
+	Props []PropMapping `yaml:"props"`
+}
+
+type PropMapping struct {
+	Name string `yaml:"name"`
+	// column of the value, default the property name.
+	Column string `yaml:"column"`
+	// string, int, double, bool, date, time, datetime or timestamp, default string.
+	Type string `yaml:"type"`
 }
 
 type Chain struct {
@@ -58,10 +265,40 @@ type Chain struct {
 }
 
 type Nebula struct {
-	Address  string `yaml:"address"`
-	Port     int    `yaml:"port"`
-	UserName string `yaml:"user_name"`
-	Password string `yaml:"password"`
+	// single graphd, used without Hosts.
+	Address string `yaml:"address"`
+	Port    int    `yaml:"port"`
+	// graphd hosts of a cluster as host:port.
+	Hosts    []string `yaml:"hosts"`
+	UserName string   `yaml:"user_name"`
+	Password string   `yaml:"password"`
+
+	// connections shared by the api and the replay.
+	MaxConnPoolSize int `yaml:"max_conn_pool_size"`
+	MinConnPoolSize int `yaml:"min_conn_pool_size"`
+	// socket timeout, zero for none.
+	Timeout time.Duration `yaml:"timeout"`
+	// idle connections are closed after IdleTime, zero keeps them.
+	IdleTime time.Duration `yaml:"idle_time"`
+	// interval between health checks of the graphd hosts.
+	HealthInterval time.Duration `yaml:"health_interval"`
+
+	TLS NebulaTLS `yaml:"tls"`
+}
+
+type NebulaTLS struct {
+	Enable bool `yaml:"enable"`
+	// pem files for server verification and client certificates.
+	CAFile             string `yaml:"ca_file"`
+	CertFile           string `yaml:"cert_file"`
+	KeyFile            string `yaml:"key_file"`
+	ServerName         string `yaml:"server_name"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
+
+type Graph struct {
+	// nebula or memory, the memory store keeps nothing across restarts.
+	Backend string `yaml:"backend"`
 }
 
 var DefaultConfig Config
@@ -71,6 +308,34 @@ var (
 	DefaultSSHUser = "root"
 
 	DefaultServerPort = 8080
+
+	DefaultReplayBatchSize  = 100
+	DefaultReplayWorkers    = 4
+	DefaultSchemaTimeout    = 60 * time.Second
+	DefaultRebuildTimeout   = 30 * time.Minute
+	DefaultGapWait          = time.Hour
+	DefaultKeepVersions     = 1
+	DefaultReimportAttempts = 1
+	DefaultWriteRetries     = 5
+	DefaultSlowWrite        = 10 * time.Second
+	DefaultBreakerPause     = 30 * time.Second
+
+	DefaultNebulaPoolSize       = 10
+	DefaultNebulaHealthInterval = 30 * time.Second
+
+	DefaultDialTimeout    = 30 * time.Second
+	DefaultRequestTimeout = 60 * time.Second
+)
+
+const (
+	GraphNebula = "nebula"
+	GraphMemory = "memory"
+)
+
+const (
+	RetentionKeep     = "keep"
+	RetentionDelete   = "delete"
+	RetentionCompress = "compress"
 )
 
 func Load(file string) (*Config, error) {
@@ -78,6 +343,8 @@ func Load(file string) (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	// unset keep_versions stays negative.
+	DefaultConfig.Replay.KeepVersions = -1
 	err = yaml.Unmarshal(bs, &DefaultConfig)
 	if err != nil {
 		return nil, err
@@ -86,6 +353,85 @@ func Load(file string) (*Config, error) {
 		DefaultConfig.Server.Port = int64(DefaultServerPort)
 	}
 
+	if DefaultConfig.Server.HTTPClient.DialTimeout == 0 {
+		DefaultConfig.Server.HTTPClient.DialTimeout = DefaultDialTimeout
+	}
+	if DefaultConfig.Server.HTTPClient.RequestTimeout == 0 {
+		DefaultConfig.Server.HTTPClient.RequestTimeout = DefaultRequestTimeout
+	}
+
+	if DefaultConfig.Replay.BatchSize <= 0 {
+		DefaultConfig.Replay.BatchSize = DefaultReplayBatchSize
+	}
+	if DefaultConfig.Replay.Workers <= 0 {
+		DefaultConfig.Replay.Workers = DefaultReplayWorkers
+	}
+	if DefaultConfig.Replay.SchemaTimeout <= 0 {
+		DefaultConfig.Replay.SchemaTimeout = DefaultSchemaTimeout
+	}
+	if DefaultConfig.Replay.RebuildTimeout <= 0 {
+		DefaultConfig.Replay.RebuildTimeout = DefaultRebuildTimeout
+	}
+
+	switch DefaultConfig.Replay.GapPolicy {
+	case "":
+		DefaultConfig.Replay.GapPolicy = GapWait
+	case GapWait, GapSkip, GapFail:
+	default:
+		return nil, xerrors.Errorf("unknown replay gap_policy: %q", DefaultConfig.Replay.GapPolicy)
+	}
+	if DefaultConfig.Replay.GapWait <= 0 {
+		DefaultConfig.Replay.GapWait = DefaultGapWait
+	}
+	switch DefaultConfig.Replay.InDoubt {
+	case "":
+		DefaultConfig.Replay.InDoubt = InDoubtFail
+	case InDoubtFail, InDoubtRetry, InDoubtSkip:
+	default:
+		return nil, xerrors.Errorf("unknown replay in_doubt: %q", DefaultConfig.Replay.InDoubt)
+	}
+	if DefaultConfig.Replay.KeepVersions < 0 {
+		DefaultConfig.Replay.KeepVersions = DefaultKeepVersions
+	}
+	if DefaultConfig.Replay.ReimportAttempts <= 0 {
+		DefaultConfig.Replay.ReimportAttempts = DefaultReimportAttempts
+	}
+	if DefaultConfig.Replay.WriteRetries <= 0 {
+		DefaultConfig.Replay.WriteRetries = DefaultWriteRetries
+	}
+	if DefaultConfig.Replay.SlowWrite <= 0 {
+		DefaultConfig.Replay.SlowWrite = DefaultSlowWrite
+	}
+	if DefaultConfig.Replay.BreakerPause <= 0 {
+		DefaultConfig.Replay.BreakerPause = DefaultBreakerPause
+	}
+
+	if DefaultConfig.Nebula.MaxConnPoolSize <= 0 {
+		// a replay worker or api query holds a session while it executes, the
+		// graph store keeps two idle sessions per space and at most half of
+		// the pool idle.
+		DefaultConfig.Nebula.MaxConnPoolSize = DefaultNebulaPoolSize + 2*DefaultConfig.Replay.Workers
+	}
+	if DefaultConfig.Nebula.HealthInterval <= 0 {
+		DefaultConfig.Nebula.HealthInterval = DefaultNebulaHealthInterval
+	}
+	if DefaultConfig.Graph.Backend == "" {
+		DefaultConfig.Graph.Backend = GraphNebula
+	}
+
+	switch DefaultConfig.Storage.ReplayedPolicy {
+	case "":
+		DefaultConfig.Storage.ReplayedPolicy = RetentionKeep
+	case RetentionKeep, RetentionDelete, RetentionCompress:
+	default:
+		return nil, xerrors.Errorf("unknown storage replayed_policy: %q", DefaultConfig.Storage.ReplayedPolicy)
+	}
+	switch DefaultConfig.Storage.Compression {
+	case utils.CodecNone, utils.CodecGzip, utils.CodecZstd:
+	default:
+		return nil, xerrors.Errorf("unknown storage compression: %q", DefaultConfig.Storage.Compression)
+	}
+
 	for _, chain := range DefaultConfig.Chains {
 		if chain.SSHPort == 0 {
 			chain.SSHPort = DefaultSSHPort
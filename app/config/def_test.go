@@ -0,0 +1,64 @@
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func loadTestConfig(t *testing.T, content string) (*Config, error) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	DefaultConfig = Config{}
+	return Load(path)
+}
+
+func TestLoadKeepVersions(t *testing.T) {
+	tests := []struct {
+		content string
+		want    int
+	}{
+		{"replay:\n  workers: 1\n", DefaultKeepVersions},
+		{"replay:\n  keep_versions: 0\n", 0},
+		{"replay:\n  keep_versions: 3\n", 3},
+	}
+	for _, tt := range tests {
+		conf, err := loadTestConfig(t, tt.content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if conf.Replay.KeepVersions != tt.want {
+			t.Errorf("%q: keep versions %d", tt.content, conf.Replay.KeepVersions)
+		}
+	}
+}
+
+func TestLoadReplayPolicies(t *testing.T) {
+	tests := []struct {
+		content string
+		valid   bool
+	}{
+		{"replay:\n  gap_policy: skip\n  in_doubt: retry\n", true},
+		{"replay:\n  gap_policy: fail\n  in_doubt: skip\n", true},
+		{"replay:\n  gap_policy: ignore\n", false},
+		{"replay:\n  in_doubt: redo\n", false},
+		{"storage:\n  replayed_policy: delete\n  compression: zstd\n", true},
+		{"storage:\n  replayed_policy: compress\n  compression: gzip\n", true},
+		{"storage:\n  replayed_policy: remove\n", false},
+		{"storage:\n  compression: lz4\n", false},
+	}
+	for _, tt := range tests {
+		if _, err := loadTestConfig(t, tt.content); (err == nil) != tt.valid {
+			t.Errorf("%q: %v", tt.content, err)
+		}
+	}
+	conf, err := loadTestConfig(t, "replay:\n  workers: 1\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.Replay.GapPolicy != GapWait || conf.Replay.InDoubt != InDoubtFail || conf.Storage.ReplayedPolicy != RetentionKeep {
+		t.Errorf("defaults %s %s %s", conf.Replay.GapPolicy, conf.Replay.InDoubt, conf.Storage.ReplayedPolicy)
+	}
+}
@@ -12,4 +12,10 @@ var (
 		Value:       "conf/config.yml",
 		Destination: &configPath,
 	}
+
+	// DryRunFlag report without changing anything
+	DryRunFlag = cli.BoolFlag{
+		Name:  "dry-run",
+		Usage: "only report what would be done",
+	}
 )
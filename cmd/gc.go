@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/EpiK-Protocol/go-epik-gateway/app/config"
+	"github.com/EpiK-Protocol/go-epik-gateway/storage"
+	"github.com/EpiK-Protocol/go-epik-gateway/task"
+	"github.com/EpiK-Protocol/go-epik-gateway/utils/logging"
+)
+
+var gcCommand = &cli.Command{
+	Name:   "gc",
+	Usage:  "remove files in data dir which no file reference uses",
+	Flags:  []cli.Flag{&DryRunFlag},
+	Action: gcAction,
+}
+
+func gcAction(ctx *cli.Context) error {
+	conf, err := config.Load(configPath)
+	if err != nil {
+		return err
+	}
+	logging.Init(conf.App.LogDir, conf.App.Name, conf.App.LogLevel, conf.App.LogAge)
+
+	st, err := storage.NewBadgerStorage(conf.Storage.DBDir)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	dryRun := ctx.Bool(DryRunFlag.Name)
+	paths, err := task.CollectGarbage(*conf, st, dryRun)
+	for _, path := range paths {
+		if dryRun {
+			fmt.Println("orphaned:", path)
+		} else {
+			fmt.Println("removed:", path)
+		}
+	}
+	return err
+}
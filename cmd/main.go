@@ -37,6 +37,7 @@ func main() {
 	app.Copyright = ""
 
 	app.Flags = append(app.Flags, &ConfigFlag)
+	app.Commands = append(app.Commands, gcCommand, rebuildCommand, validateCommand)
 
 	sort.Sort(cli.FlagsByName(app.Flags))
 
@@ -73,7 +74,7 @@ func makeNode(ctx *cli.Context) (*app.App, error) {
 }
 
 func runNode(ctx *cli.Context, a *app.App) chan bool {
-	c := make(chan os.Signal)
+	c := make(chan os.Signal, 1)
 	signal.Notify(c, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 
 	if err := a.Start(); err != nil {
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/EpiK-Protocol/go-epik-gateway/app/config"
+	"github.com/EpiK-Protocol/go-epik-gateway/task"
+)
+
+var (
+	expertFlag = cli.StringFlag{
+		Name:     "expert",
+		Usage:    "expert `ADDRESS` to rebuild",
+		Required: true,
+	}
+	rebuildModeFlag = cli.StringFlag{
+		Name:  "mode",
+		Usage: "drop the space before re-import, keep it or import into a shadow version",
+		Value: task.RebuildDrop,
+	}
+	tokenFlag = cli.StringFlag{
+		Name:  "token",
+		Usage: "confirmation `TOKEN` returned by the dry run",
+	}
+	apiFlag = cli.StringFlag{
+		Name:  "api",
+		Usage: "`URL` of the running gateway, the server port of the config by default",
+	}
+)
+
+var rebuildCommand = &cli.Command{
+	Name:   "rebuild-expert",
+	Usage:  "re-import all files of an expert through the running gateway",
+	Flags:  []cli.Flag{&expertFlag, &rebuildModeFlag, &DryRunFlag, &tokenFlag, &apiFlag},
+	Action: rebuildAction,
+}
+
+func rebuildAction(ctx *cli.Context) error {
+	dryRun := ctx.Bool(DryRunFlag.Name)
+	token := ctx.String(tokenFlag.Name)
+	if !dryRun && token == "" {
+		return xerrors.New("run with --dry-run first and confirm the plan with --token")
+	}
+
+	api := ctx.String(apiFlag.Name)
+	if api == "" {
+		conf, err := config.Load(configPath)
+		if err != nil {
+			return err
+		}
+		api = fmt.Sprintf("http://127.0.0.1:%d", conf.Server.Port)
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"mode":    ctx.String(rebuildModeFlag.Name),
+		"dry_run": dryRun,
+		"token":   token,
+	})
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: time.Hour}
+	resp, err := client.Post(fmt.Sprintf("%s/replay/experts/%s/rebuild", api, url.PathEscape(ctx.String(expertFlag.Name))), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	result := &struct {
+		Code struct {
+			Code    int64  `json:"code"`
+			Message string `json:"message"`
+		} `json:"code"`
+		Data *task.RebuildPlan `json:"data"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return xerrors.Errorf("decode response of %s: %w", resp.Status, err)
+	}
+	if result.Code.Code != 0 {
+		return xerrors.Errorf("rebuild refused: %s", result.Code.Message)
+	}
+
+	plan := result.Data
+	fmt.Printf("expert: %s\nspace: %s\nmode: %s\nreplayed: index %d line %d\n", plan.Expert, plan.Space, plan.Mode, plan.Index, plan.Line)
+	for _, file := range plan.Files {
+		if file.Download {
+			fmt.Printf("file %d: %s (download)\n", file.Index, file.ID)
+		} else {
+			fmt.Printf("file %d: %s\n", file.Index, file.ID)
+		}
+	}
+	if plan.DryRun {
+		fmt.Printf("confirm with: --token %s\n", plan.Token)
+	} else {
+		fmt.Println("rebuild started.")
+	}
+	return nil
+}
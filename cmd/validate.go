@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/EpiK-Protocol/go-epik-gateway/app/config"
+	"github.com/EpiK-Protocol/go-epik-gateway/graph"
+	"github.com/EpiK-Protocol/go-epik-gateway/task"
+)
+
+var (
+	validateExpertFlag = cli.StringFlag{
+		Name:  "expert",
+		Usage: "expert `ADDRESS` of the files, it selects the space and mapping of the config",
+	}
+	ngqlFlag = cli.BoolFlag{
+		Name:  "ngql",
+		Usage: "print the generated nGQL",
+	}
+	jsonFlag = cli.BoolFlag{
+		Name:  "json",
+		Usage: "print the reports as json",
+	}
+)
+
+var validateCommand = &cli.Command{
+	Name:      "validate-file",
+	Usage:     "check local expert files through the replay parsing without writing anything",
+	ArgsUsage: "FILE... (in index order, later files see the schema created by earlier ones)",
+	Flags:     []cli.Flag{&validateExpertFlag, &ngqlFlag, &jsonFlag},
+	Action:    validateAction,
+}
+
+func validateAction(ctx *cli.Context) error {
+	if ctx.NArg() == 0 {
+		return xerrors.New("no file to validate")
+	}
+	conf, err := config.Load(configPath)
+	if err != nil {
+		return err
+	}
+
+	opts := task.ValidateOptions{Schema: graph.NewSchema(), NGQL: ctx.Bool(ngqlFlag.Name)}
+	reports := []*task.ValidateReport{}
+	invalid := 0
+	for _, path := range ctx.Args().Slice() {
+		file := &task.FileRef{ID: filepath.Base(path), Expert: ctx.String(validateExpertFlag.Name), LocalPath: path}
+		report, err := task.ValidateFile(*conf, file, opts)
+		if err != nil {
+			return xerrors.Errorf("file %s: %w", path, err)
+		}
+		opts.Space = report.Space
+		if !report.Valid {
+			invalid++
+		}
+		reports = append(reports, report)
+	}
+
+	if ctx.Bool(jsonFlag.Name) {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(reports); err != nil {
+			return err
+		}
+	} else {
+		for _, report := range reports {
+			printReport(report)
+		}
+	}
+	if invalid > 0 {
+		return xerrors.Errorf("%d of %d files invalid", invalid, len(reports))
+	}
+	return nil
+}
+
+func printReport(report *task.ValidateReport) {
+	index := int64(0)
+	if report.Header != nil {
+		index = report.Header.Index
+	}
+	fmt.Printf("file: %s\nindex: %d\nspace: %s\nlines: %d\n", report.File, index, report.Space, report.Lines)
+	kinds := make([]string, 0, len(report.Statements))
+	for kind := range report.Statements {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	counts := make([]string, 0, len(kinds))
+	for _, kind := range kinds {
+		counts = append(counts, fmt.Sprintf("%s %d", kind, report.Statements[kind]))
+	}
+	fmt.Printf("statements: %s\nrejected: %d\n", strings.Join(counts, ", "), report.Rejected)
+	for _, issue := range report.Errors {
+		fmt.Printf("error line %d: %s\n", issue.Line, issue.Message)
+	}
+	for _, issue := range report.Warnings {
+		fmt.Printf("warning line %d: %s\n", issue.Line, issue.Message)
+	}
+	for _, line := range report.NGQL {
+		fmt.Printf("ngql line %d: %s\n", line.Line, line.NGQL)
+	}
+	if report.Valid {
+		fmt.Printf("valid, %d warnings\n\n", report.WarningCount)
+	} else {
+		fmt.Printf("invalid, %d errors, %d warnings\n\n", report.ErrorCount, report.WarningCount)
+	}
+}
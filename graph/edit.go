@@ -0,0 +1,242 @@
+package graph
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Schema returns whether the statement is about a tag or an edge, empty for
+// other statements.
+func (s *Statement) Schema() string {
+	switch s.Kind {
+	case StatementCreateTag, StatementCreateTagIndex, StatementInsertVertex, StatementUpsertVertex:
+		return SchemaTag
+	case StatementCreateEdge, StatementCreateEdgeIndex, StatementInsertEdge, StatementUpsertEdge:
+		return SchemaEdge
+	}
+	return ""
+}
+
+// Names returns the tags or edges of the statement.
+func (s *Statement) Names() []string {
+	if s.Kind == StatementInsertVertex {
+		return s.Tags
+	}
+	if s.Schema() == "" {
+		return nil
+	}
+	return []string{s.Name}
+}
+
+// offset returns the index of the first value of name in the rows.
+func (s *Statement) offset(name string) int {
+	offset := 0
+	for _, n := range s.Names() {
+		if n == name {
+			break
+		}
+		offset += len(s.Props[n])
+	}
+	return offset
+}
+
+// RenameSchema renames the tag or edge from, it reports whether the
+// statement changed.
+func (s *Statement) RenameSchema(schema string, from string, to string) bool {
+	if s.Schema() != schema || from == to {
+		return false
+	}
+	props, ok := s.Props[from]
+	if !ok && s.Name != from {
+		return false
+	}
+	for i, tag := range s.Tags {
+		if tag == from {
+			s.Tags[i] = to
+		}
+	}
+	if s.Name == from {
+		s.Name = to
+	}
+	if ok {
+		delete(s.Props, from)
+		s.Props[to] = props
+	}
+	s.edited = true
+	return true
+}
+
+// RenameProp renames the property from of the tag or edge name.
+func (s *Statement) RenameProp(schema string, name string, from string, to string) bool {
+	return s.RenameProps(schema, name, map[string]string{from: to})
+}
+
+// RenameProps renames the properties of the tag or edge name at once, each
+// property is looked up by its name before the renames.
+func (s *Statement) RenameProps(schema string, name string, renames map[string]string) bool {
+	if s.Schema() != schema {
+		return false
+	}
+	changed := false
+	for i, prop := range s.Props[name] {
+		if to, ok := renames[prop]; ok && to != prop {
+			s.Props[name][i] = to
+			changed = true
+		}
+	}
+	s.edited = s.edited || changed
+	return changed
+}
+
+// DropProp removes the property of the tag or edge name with its type and
+// values, an index keeps its other fields.
+func (s *Statement) DropProp(schema string, name string, prop string) bool {
+	if s.Schema() != schema {
+		return false
+	}
+	props := s.Props[name]
+	i := indexOf(props, prop)
+	if i < 0 {
+		return false
+	}
+	offset := s.offset(name) + i
+	s.Props[name] = append(props[:i:i], props[i+1:]...)
+	if i < len(s.Types) {
+		s.Types = append(s.Types[:i:i], s.Types[i+1:]...)
+	}
+	if i < len(s.Defs) {
+		s.Defs = append(s.Defs[:i:i], s.Defs[i+1:]...)
+	}
+	for _, row := range s.Rows {
+		if offset < len(row.Values) {
+			row.Values = append(row.Values[:offset:offset], row.Values[offset+1:]...)
+		}
+	}
+	s.edited = true
+	return true
+}
+
+// AddProp adds a property to a created tag or edge name with its definition,
+// eg: "string", and writes value to it by inserts and upserts. Indexes and
+// existing properties are left.
+func (s *Statement) AddProp(schema string, name string, prop string, def string, value string) bool {
+	if s.Schema() != schema || s.Kind == StatementCreateTagIndex || s.Kind == StatementCreateEdgeIndex {
+		return false
+	}
+	props, ok := s.Props[name]
+	if !ok || indexOf(props, prop) >= 0 {
+		return false
+	}
+	offset := s.offset(name) + len(props)
+	s.Props[name] = append(props[:len(props):len(props)], prop)
+	if s.Kind == StatementCreateTag || s.Kind == StatementCreateEdge {
+		s.Types = append(s.Types, def)
+		s.Defs = append(s.Defs, def)
+	}
+	for _, row := range s.Rows {
+		values := append([]string{}, row.Values[:offset]...)
+		values = append(values, value)
+		row.Values = append(values, row.Values[offset:]...)
+	}
+	s.edited = true
+	return true
+}
+
+// MapVIDs replaces the vertex ids of an insert or upsert, and the source and
+// destination of edges.
+func (s *Statement) MapVIDs(fn func(vid string) string) bool {
+	if !s.IsInsert() {
+		return false
+	}
+	for _, row := range s.Rows {
+		if s.Schema() == SchemaTag {
+			row.ID = fn(row.ID)
+		} else {
+			row.Src = fn(row.Src)
+			row.Dst = fn(row.Dst)
+		}
+	}
+	s.edited = true
+	return true
+}
+
+func indexOf(names []string, name string) int {
+	for i, n := range names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func quoteIdents(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = QuoteIdent(name)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func (s *Statement) rowKey(row *Row) string {
+	if s.Schema() == SchemaTag {
+		return row.ID
+	}
+	if row.Rank != 0 {
+		return fmt.Sprintf("%s->%s@%d", row.Src, row.Dst, row.Rank)
+	}
+	return row.Src + "->" + row.Dst
+}
+
+// format renders an edited statement from its fields.
+func (s *Statement) format() string {
+	var b strings.Builder
+	b.WriteString(string(s.Kind))
+	if s.IfNotExists {
+		b.WriteString(" IF NOT EXISTS")
+	}
+	if s.noOverwrite {
+		b.WriteString(" NO OVERWRITE")
+	}
+	props := s.Props[s.Name]
+	switch s.Kind {
+	case StatementCreateTag, StatementCreateEdge:
+		defs := make([]string, len(props))
+		for i, prop := range props {
+			defs[i] = QuoteIdent(prop)
+			if i < len(s.Defs) && s.Defs[i] != "" {
+				defs[i] += " " + s.Defs[i]
+			}
+		}
+		fmt.Fprintf(&b, " %s(%s)", QuoteIdent(s.Name), strings.Join(defs, ", "))
+	case StatementCreateTagIndex, StatementCreateEdgeIndex:
+		fields := make([]string, len(props))
+		for i, prop := range props {
+			fields[i] = QuoteIdent(prop)
+			if i < len(s.Defs) {
+				fields[i] += s.Defs[i]
+			}
+		}
+		fmt.Fprintf(&b, " %s ON %s(%s)", QuoteIdent(s.Index), QuoteIdent(s.Name), strings.Join(fields, ", "))
+	case StatementInsertVertex, StatementInsertEdge:
+		schemas := []string{}
+		for _, name := range s.Names() {
+			schemas = append(schemas, fmt.Sprintf("%s(%s)", QuoteIdent(name), quoteIdents(s.Props[name])))
+		}
+		rows := make([]string, len(s.Rows))
+		for i, row := range s.Rows {
+			rows[i] = fmt.Sprintf("%s:(%s)", s.rowKey(row), strings.Join(row.Values, ", "))
+		}
+		fmt.Fprintf(&b, " %s VALUES %s", strings.Join(schemas, ", "), strings.Join(rows, ", "))
+	case StatementUpsertVertex, StatementUpsertEdge:
+		row := s.Rows[0]
+		sets := make([]string, len(props))
+		for i, prop := range props {
+			sets[i] = fmt.Sprintf("%s = %s", QuoteIdent(prop), row.Values[i])
+		}
+		fmt.Fprintf(&b, " ON %s %s SET %s", QuoteIdent(s.Name), s.rowKey(row), strings.Join(sets, ", "))
+	}
+	if s.Tail != "" {
+		b.WriteString(" " + s.Tail)
+	}
+	return b.String()
+}
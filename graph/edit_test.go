@@ -0,0 +1,151 @@
+package graph
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func parseOne(t *testing.T, sql string) *Statement {
+	stmts, err := ParseNGQL(sql)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stmts[0]
+}
+
+// checkEdited checks the edited statement renders want and parses again
+// into the same fields.
+func checkEdited(t *testing.T, stmt *Statement, want string) {
+	t.Helper()
+	got := stmt.String()
+	if got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+	again := parseOne(t, got)
+	if !reflect.DeepEqual(again.Props, stmt.Props) || !reflect.DeepEqual(again.Rows, stmt.Rows) || again.Tail != stmt.Tail {
+		t.Errorf("%s parses into other fields", got)
+	}
+}
+
+func TestRenameProps(t *testing.T) {
+	tests := []struct {
+		sql     string
+		name    string
+		renames map[string]string
+		want    string
+	}{
+		// renames apply to the names before renaming, they don't chain.
+		{"CREATE TAG person(name string, age int)", "person", map[string]string{"age": "name", "name": "title"},
+			"CREATE TAG person(title string, name int)"},
+		{`INSERT VERTEX a(x), b(x, y) VALUES "v":(1, 2, 3)`, "b", map[string]string{"x": "order"},
+			"INSERT VERTEX a(x), b(`order`, y) VALUES \"v\":(1, 2, 3)"},
+		{`UPSERT EDGE ON e "a"->"b"@1 SET w = w + 1, n = "x" WHEN w < 10 YIELD w`, "e", map[string]string{"n": "m"},
+			`UPSERT EDGE ON e "a"->"b"@1 SET w = w + 1, m = "x" WHEN w < 10 YIELD w`},
+		{"CREATE TAG INDEX i ON t(v(16), w)", "t", map[string]string{"v": "value"},
+			"CREATE TAG INDEX i ON t(value(16), w)"},
+	}
+	for _, tt := range tests {
+		stmt := parseOne(t, tt.sql)
+		if !stmt.RenameProps(stmt.Schema(), tt.name, tt.renames) {
+			t.Fatalf("%s: not renamed", tt.sql)
+		}
+		checkEdited(t, stmt, tt.want)
+	}
+
+	stmt := parseOne(t, "CREATE TAG t(v string)")
+	if stmt.RenameProp(SchemaEdge, "t", "v", "w") || stmt.RenameProp(SchemaTag, "t", "x", "w") {
+		t.Error("renamed a missing property")
+	}
+	if stmt.String() != "CREATE TAG t(v string)" {
+		t.Errorf("unchanged statement rendered %s", stmt.String())
+	}
+}
+
+func TestRenameSchema(t *testing.T) {
+	stmt := parseOne(t, `INSERT VERTEX a(x), b(y) VALUES "v":(1, 2)`)
+	if !stmt.RenameSchema(SchemaTag, "b", "tag") {
+		t.Fatal("not renamed")
+	}
+	checkEdited(t, stmt, "INSERT VERTEX a(x), `tag`(y) VALUES \"v\":(1, 2)")
+	if stmt.RenameSchema(SchemaEdge, "a", "c") {
+		t.Error("renamed a tag as an edge")
+	}
+}
+
+func TestDropProp(t *testing.T) {
+	tests := []struct {
+		sql  string
+		name string
+		prop string
+		want string
+	}{
+		{"CREATE TAG IF NOT EXISTS p(name string NOT NULL, age int DEFAULT 1) TTL_DURATION = 10", "p", "name",
+			"CREATE TAG IF NOT EXISTS p(age int DEFAULT 1) TTL_DURATION = 10"},
+		{`INSERT VERTEX a(x, y), b(x, z) VALUES "v":(1, 2, 3, 4), "w":(5, 6, 7, 8)`, "b", "x",
+			`INSERT VERTEX a(x, y), b(z) VALUES "v":(1, 2, 4), "w":(5, 6, 8)`},
+		{`INSERT VERTEX a(x, y), b(x, z) VALUES "v":(1, 2, 3, 4)`, "a", "y",
+			`INSERT VERTEX a(x), b(x, z) VALUES "v":(1, 3, 4)`},
+		{`INSERT EDGE NO OVERWRITE e(w, n) VALUES "a"->"b"@2:(1, "x")`, "e", "w",
+			`INSERT EDGE NO OVERWRITE e(n) VALUES "a"->"b"@2:("x")`},
+		{`UPSERT VERTEX ON p "v" SET n = n + 1, m = "x" WHEN n > 1 YIELD n`, "p", "m",
+			`UPSERT VERTEX ON p "v" SET n = n + 1 WHEN n > 1 YIELD n`},
+		{"CREATE EDGE INDEX i ON e(n(8), w)", "e", "n", "CREATE EDGE INDEX i ON e(w)"},
+	}
+	for _, tt := range tests {
+		stmt := parseOne(t, tt.sql)
+		if !stmt.DropProp(stmt.Schema(), tt.name, tt.prop) {
+			t.Fatalf("%s: not dropped", tt.sql)
+		}
+		checkEdited(t, stmt, tt.want)
+	}
+}
+
+func TestAddProp(t *testing.T) {
+	tests := []struct {
+		sql   string
+		name  string
+		added bool
+		want  string
+	}{
+		{"CREATE TAG p(name string) COMMENT = \"c\"", "p", true, "CREATE TAG p(name string, src string) COMMENT = \"c\""},
+		{"CREATE EDGE e()", "e", true, "CREATE EDGE e(src string)"},
+		{`INSERT VERTEX a(x), b(y) VALUES "v":(1, 2), "w":(3, 4)`, "a", true,
+			`INSERT VERTEX a(x, src), b(y) VALUES "v":(1, "f", 2), "w":(3, "f", 4)`},
+		{`INSERT VERTEX a(x), b(y) VALUES "v":(1, 2)`, "b", true, `INSERT VERTEX a(x), b(y, src) VALUES "v":(1, 2, "f")`},
+		{`UPSERT EDGE ON e "a"->"b" SET w = w + 1 WHEN w < 10 YIELD w`, "e", true,
+			`UPSERT EDGE ON e "a"->"b" SET w = w + 1, src = "f" WHEN w < 10 YIELD w`},
+		{`INSERT VERTEX a(x, src) VALUES "v":(1, 2)`, "a", false, `INSERT VERTEX a(x, src) VALUES "v":(1, 2)`},
+		{"CREATE TAG INDEX i ON a(x)", "a", false, "CREATE TAG INDEX i ON a(x)"},
+	}
+	for _, tt := range tests {
+		stmt := parseOne(t, tt.sql)
+		if added := stmt.AddProp(stmt.Schema(), tt.name, "src", "string", `"f"`); added != tt.added {
+			t.Fatalf("%s: added %v", tt.sql, added)
+		}
+		checkEdited(t, stmt, tt.want)
+	}
+}
+
+func TestMapVIDs(t *testing.T) {
+	upper := func(vid string) string { return strings.ToUpper(vid) }
+	tests := []struct {
+		sql  string
+		want string
+	}{
+		{`INSERT VERTEX a(x), b(y) VALUES "v":(1, 2), "w":(3, 4)`, `INSERT VERTEX a(x), b(y) VALUES "V":(1, 2), "W":(3, 4)`},
+		{`INSERT EDGE e(w) VALUES "a"->"b"@3:(1), "b"->"c":(2)`, `INSERT EDGE e(w) VALUES "A"->"B"@3:(1), "B"->"C":(2)`},
+		{`UPSERT VERTEX ON p "v" SET n = "v" WHEN n > 1 YIELD n`, `UPSERT VERTEX ON p "V" SET n = "v" WHEN n > 1 YIELD n`},
+		{`UPSERT EDGE ON e "a"->"b"@1 SET w = 1 YIELD w`, `UPSERT EDGE ON e "A"->"B"@1 SET w = 1 YIELD w`},
+	}
+	for _, tt := range tests {
+		stmt := parseOne(t, tt.sql)
+		if !stmt.MapVIDs(upper) {
+			t.Fatalf("%s: not mapped", tt.sql)
+		}
+		checkEdited(t, stmt, tt.want)
+	}
+	if parseOne(t, "CREATE TAG t(v string)").MapVIDs(upper) {
+		t.Error("mapped vids of a create")
+	}
+}
@@ -0,0 +1,423 @@
+package graph
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/xerrors"
+)
+
+// ErrUnsupported is returned by the memory store for statements it can't
+// run.
+var ErrUnsupported = xerrors.New("unsupported statement")
+
+type edgeKey struct {
+	name string
+	src  string
+	dst  string
+	rank int64
+}
+
+type memorySpace struct {
+	schema *Schema
+	// edge types in creation order from 1.
+	edgeTypes map[string]int64
+
+	vertices map[string]map[string]interface{}
+	// tags of the vertices, a tag may have no property.
+	tagged map[string]map[string]bool
+	rels   map[edgeKey]map[string]interface{}
+}
+
+func newMemorySpace() *memorySpace {
+	return &memorySpace{
+		schema:    NewSchema(),
+		edgeTypes: map[string]int64{},
+		vertices:  map[string]map[string]interface{}{},
+		tagged:    map[string]map[string]bool{},
+		rels:      map[edgeKey]map[string]interface{}{},
+	}
+}
+
+// MemoryStore is a graph store in memory for tests and trials without a
+// database. Values are kept when they are literals, other expressions as
+// their source, and upsert conditions are not evaluated.
+type MemoryStore struct {
+	lk     sync.RWMutex
+	spaces map[string]*memorySpace
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{spaces: map[string]*memorySpace{}}
+}
+
+func (m *MemoryStore) space(space string) (*memorySpace, error) {
+	s, ok := m.spaces[space]
+	if !ok {
+		return nil, xerrors.Errorf("space %s not found", space)
+	}
+	return s, nil
+}
+
+func (m *MemoryStore) CreateSchema(space string, stmts []*Statement, redo bool) error {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	for _, stmt := range stmts {
+		tolerate := stmt.IfNotExists || redo
+		if stmt.Kind == StatementCreateSpace {
+			if _, ok := m.spaces[space]; ok && !tolerate {
+				return xerrors.Errorf("space %s existed", space)
+			} else if !ok {
+				m.spaces[space] = newMemorySpace()
+			}
+			continue
+		}
+		if !stmt.IsSchema() {
+			continue
+		}
+		s, err := m.space(space)
+		if err != nil {
+			return err
+		}
+		schemas := s.schema.Tags
+		if stmt.Kind == StatementCreateEdge || stmt.Kind == StatementCreateEdgeIndex {
+			schemas = s.schema.Edges
+		}
+		switch stmt.Kind {
+		case StatementCreateTag, StatementCreateEdge:
+			if _, ok := schemas[stmt.Name]; ok && !tolerate {
+				return xerrors.Errorf("%s %s existed", stmt.Kind[len("CREATE "):], stmt.Name)
+			}
+			if s.schema.Apply(stmt) && stmt.Kind == StatementCreateEdge {
+				s.edgeTypes[stmt.Name] = int64(len(s.edgeTypes) + 1)
+			}
+		case StatementCreateTagIndex, StatementCreateEdgeIndex:
+			if _, ok := schemas[stmt.Name]; !ok {
+				return xerrors.Errorf("%s of index %s not found", stmt.Name, stmt.Index)
+			}
+			if _, ok := s.schema.Indexes[stmt.Index]; ok && !tolerate {
+				return xerrors.Errorf("index %s existed", stmt.Index)
+			}
+			s.schema.Apply(stmt)
+		}
+	}
+	return nil
+}
+
+// rowProps maps the values of row to the properties of names in stmt, the
+// properties are checked against the schemas.
+func rowProps(schemas map[string][]*Prop, stmt *Statement, names []string, row *Row, prefix bool) (map[string]interface{}, error) {
+	props := map[string]interface{}{}
+	i := 0
+	for _, name := range names {
+		defined, ok := schemas[name]
+		if !ok {
+			return nil, xerrors.Errorf("%s not found", name)
+		}
+		for _, prop := range stmt.Props[name] {
+			if !contains(defined, prop) {
+				return nil, xerrors.Errorf("property %s of %s not found", prop, name)
+			}
+			if i >= len(row.Values) {
+				return nil, xerrors.Errorf("values of %s don't match its properties", name)
+			}
+			key := prop
+			if prefix {
+				key = name + "." + prop
+			}
+			props[key] = Literal(row.Values[i])
+			i++
+		}
+	}
+	if i != len(row.Values) {
+		return nil, xerrors.Errorf("values of %s don't match its properties", stmt.Name)
+	}
+	return props, nil
+}
+
+func contains(props []*Prop, name string) bool {
+	for _, prop := range props {
+		if prop.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func literalString(expr string) string {
+	return fmt.Sprint(Literal(expr))
+}
+
+func (m *MemoryStore) Upsert(space string, stmts []*Statement) error {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	s, err := m.space(space)
+	if err != nil {
+		return err
+	}
+	for _, stmt := range stmts {
+		switch stmt.Kind {
+		case StatementInsertVertex, StatementUpsertVertex:
+			for _, row := range stmt.Rows {
+				props, err := rowProps(s.schema.Tags, stmt, stmt.Tags, row, true)
+				if err != nil {
+					return err
+				}
+				id := literalString(row.ID)
+				vertex, ok := s.vertices[id]
+				if ok && stmt.IfNotExists {
+					continue
+				}
+				if !ok {
+					vertex = map[string]interface{}{}
+					s.vertices[id] = vertex
+					s.tagged[id] = map[string]bool{}
+				}
+				for key, value := range props {
+					vertex[key] = value
+				}
+				for _, tag := range stmt.Tags {
+					s.tagged[id][tag] = true
+				}
+			}
+		case StatementInsertEdge, StatementUpsertEdge:
+			for _, row := range stmt.Rows {
+				props, err := rowProps(s.schema.Edges, stmt, []string{stmt.Name}, row, false)
+				if err != nil {
+					return err
+				}
+				key := edgeKey{name: stmt.Name, src: literalString(row.Src), dst: literalString(row.Dst), rank: row.Rank}
+				edge, ok := s.rels[key]
+				if ok && stmt.IfNotExists {
+					continue
+				}
+				if !ok {
+					edge = map[string]interface{}{}
+					s.rels[key] = edge
+				}
+				for key, value := range props {
+					edge[key] = value
+				}
+			}
+		default:
+			return fmt.Errorf("%w: %s", ErrUnsupported, stmt.Verb)
+		}
+	}
+	return nil
+}
+
+// RebuildIndex returns -1, indexes of the memory store need no rebuild.
+func (m *MemoryStore) RebuildIndex(space string, kind string) (int64, error) {
+	m.lk.RLock()
+	defer m.lk.RUnlock()
+	if _, err := m.space(space); err != nil {
+		return 0, err
+	}
+	return -1, nil
+}
+
+// SubmitStats returns -1, the memory store counts on demand.
+func (m *MemoryStore) SubmitStats(space string) (int64, error) {
+	m.lk.RLock()
+	defer m.lk.RUnlock()
+	if _, err := m.space(space); err != nil {
+		return 0, err
+	}
+	return -1, nil
+}
+
+func (m *MemoryStore) Stats(space string) (*Stats, error) {
+	m.lk.RLock()
+	defer m.lk.RUnlock()
+	s, err := m.space(space)
+	if err != nil {
+		return nil, err
+	}
+	stats := NewStats()
+	for name := range s.schema.Tags {
+		stats.Tags[name] = 0
+	}
+	for name := range s.schema.Edges {
+		stats.Edges[name] = 0
+	}
+	for _, tags := range s.tagged {
+		for tag := range tags {
+			stats.Tags[tag]++
+		}
+	}
+	for key := range s.rels {
+		stats.Edges[key.name]++
+	}
+	stats.Vertices = int64(len(s.vertices))
+	stats.Relations = int64(len(s.rels))
+	return stats, nil
+}
+
+func (m *MemoryStore) JobStatus(space string, job int64) (string, error) {
+	return "FINISHED", nil
+}
+
+func (m *MemoryStore) DropSpace(space string) error {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	delete(m.spaces, space)
+	return nil
+}
+
+func namesResult(space string, names []string) Result {
+	sort.Strings(names)
+	result := Result{Columns: []string{"Name"}, Data: []ResultData{}, SpaceName: space}
+	for _, name := range names {
+		result.Data = append(result.Data, ResultData{Row: []interface{}{name}, Meta: []interface{}{nil}})
+	}
+	return result
+}
+
+// Query runs USE, SHOW SPACES, SHOW TAGS, SHOW EDGES, schema and insert
+// statements.
+func (m *MemoryStore) Query(sql string) ([]Result, error) {
+	stmts, err := ParseNGQL(sql)
+	if err != nil {
+		return nil, err
+	}
+	space := ""
+	results := []Result{}
+	for _, stmt := range stmts {
+		switch {
+		case stmt.Kind == StatementUse:
+			m.lk.RLock()
+			_, err = m.space(stmt.Space)
+			m.lk.RUnlock()
+			space = stmt.Space
+		case stmt.Kind == StatementCreateSpace:
+			err = m.CreateSchema(stmt.Space, []*Statement{stmt}, false)
+		case stmt.IsSchema():
+			err = m.CreateSchema(space, []*Statement{stmt}, false)
+		case stmt.IsInsert():
+			err = m.Upsert(space, []*Statement{stmt})
+		case stmt.Verb == "SHOW SPACES":
+			m.lk.RLock()
+			names := []string{}
+			for name := range m.spaces {
+				names = append(names, name)
+			}
+			m.lk.RUnlock()
+			results = append(results, namesResult(space, names))
+		case stmt.Verb == "SHOW TAGS" || stmt.Verb == "SHOW EDGES":
+			m.lk.RLock()
+			s, serr := m.space(space)
+			names := []string{}
+			if serr == nil {
+				schemas := s.schema.Tags
+				if stmt.Verb == "SHOW EDGES" {
+					schemas = s.schema.Edges
+				}
+				for name := range schemas {
+					names = append(names, name)
+				}
+			}
+			m.lk.RUnlock()
+			err = serr
+			results = append(results, namesResult(space, names))
+		default:
+			err = fmt.Errorf("%w: %s", ErrUnsupported, stmt.Verb)
+		}
+		if err != nil {
+			return nil, xerrors.Errorf("memory query sql:%s: %w", strings.TrimSpace(stmt.String()), err)
+		}
+	}
+	return results, nil
+}
+
+func copyProps(props map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(props))
+	for key, value := range props {
+		copied[key] = value
+	}
+	return copied
+}
+
+// Export walks the vertices by id and the edges by name, source,
+// destination and rank.
+func (m *MemoryStore) Export(space string, vertex func(*Vertex) error, edge func(*Edge) error) error {
+	m.lk.RLock()
+	s, err := m.space(space)
+	if err != nil {
+		m.lk.RUnlock()
+		return err
+	}
+	vertices := make([]*Vertex, 0, len(s.vertices))
+	for id, props := range s.vertices {
+		vertices = append(vertices, &Vertex{ID: id, Props: copyProps(props)})
+	}
+	edges := make([]*Edge, 0, len(s.rels))
+	for key, props := range s.rels {
+		edges = append(edges, &Edge{
+			Type:  s.edgeTypes[key.name],
+			Src:   key.src,
+			Dst:   key.dst,
+			Rank:  key.rank,
+			Name:  key.name,
+			Props: copyProps(props),
+		})
+	}
+	m.lk.RUnlock()
+
+	sort.Slice(vertices, func(i, j int) bool {
+		return vertices[i].ID < vertices[j].ID
+	})
+	sort.Slice(edges, func(i, j int) bool {
+		a, b := edges[i], edges[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		if a.Src != b.Src {
+			return a.Src < b.Src
+		}
+		if a.Dst != b.Dst {
+			return a.Dst < b.Dst
+		}
+		return a.Rank < b.Rank
+	})
+	for _, v := range vertices {
+		if err := vertex(v); err != nil {
+			return err
+		}
+	}
+	for _, e := range edges {
+		if err := edge(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) Schema(space string) (*Schema, error) {
+	m.lk.RLock()
+	defer m.lk.RUnlock()
+	s, err := m.space(space)
+	if err != nil {
+		return nil, err
+	}
+	schema := NewSchema()
+	for name, props := range s.schema.Tags {
+		schema.Tags[name] = append([]*Prop{}, props...)
+	}
+	for name, props := range s.schema.Edges {
+		schema.Edges[name] = append([]*Prop{}, props...)
+	}
+	for name, index := range s.schema.Indexes {
+		schema.Indexes[name] = index
+	}
+	return schema, nil
+}
+
+func (m *MemoryStore) Health() []*HostHealth {
+	return []*HostHealth{}
+}
+
+func (m *MemoryStore) Start() {}
+
+func (m *MemoryStore) Close() {}
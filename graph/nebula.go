@@ -0,0 +1,666 @@
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	nebula "github.com/vesoft-inc/nebula-go/v2"
+	types "github.com/vesoft-inc/nebula-go/v2/nebula"
+	"golang.org/x/xerrors"
+)
+
+const (
+	schemaBackoffMin = 500 * time.Millisecond
+	schemaBackoffMax = 5 * time.Second
+
+	// idle sessions kept for each space, a session holds a pool connection.
+	idleSessionsPerSpace = 2
+)
+
+// nebulaError is a failed nebula execution.
+type nebulaError struct {
+	Code    nebula.ErrorCode
+	Message string
+	Sql     string
+}
+
+func (e *nebulaError) Error() string {
+	return fmt.Sprintf("nebula execute error sql:%s, code:%d, message:%s", e.Sql, e.Code, e.Message)
+}
+
+// isSchemaNotFound reports whether err is caused by a space, tag or edge
+// which nebula has not propagated yet.
+func isSchemaNotFound(err error) bool {
+	var nerr *nebulaError
+	if !xerrors.As(err, &nerr) {
+		return false
+	}
+	switch nerr.Code {
+	case nebula.ErrorCode(types.ErrorCode_E_SPACE_NOT_FOUND), nebula.ErrorCode(types.ErrorCode_E_TAG_NOT_FOUND),
+		nebula.ErrorCode(types.ErrorCode_E_EDGE_NOT_FOUND):
+		return true
+	}
+	return false
+}
+
+// isExisted reports whether err is nebula refusing to create an existing schema.
+func isExisted(err error) bool {
+	var nerr *nebulaError
+	if !xerrors.As(err, &nerr) {
+		return false
+	}
+	return strings.Contains(strings.ToLower(nerr.Message), "existed")
+}
+
+// IsLeaderChanged reports whether err is a write refused by a storage part
+// moving its leader. Only the failing statement was refused, the statements
+// before it in the same request were applied.
+func IsLeaderChanged(err error) bool {
+	var nerr *nebulaError
+	if !xerrors.As(err, &nerr) {
+		return false
+	}
+	msg := strings.ToLower(nerr.Message)
+	return strings.Contains(msg, "leader has changed") ||
+		strings.Contains(msg, "leader_changed")
+}
+
+// isRefused reports whether err is nebula refusing a request before
+// executing it. Leader changes and overloads may follow applied statements
+// of the request, so may execution errors.
+func isRefused(err error) bool {
+	var nerr *nebulaError
+	if !xerrors.As(err, &nerr) || IsLeaderChanged(err) || IsOverloaded(err) {
+		return false
+	}
+	return nerr.Code != nebula.ErrorCode_E_EXECUTION_ERROR
+}
+
+// IsOverloaded reports whether err is nebula failing under load, eg: storage
+// rpc timeouts or too many connections.
+func IsOverloaded(err error) bool {
+	var nerr *nebulaError
+	if !xerrors.As(err, &nerr) {
+		return false
+	}
+	switch nerr.Code {
+	case nebula.ErrorCode_E_RPC_FAILURE, nebula.ErrorCode_E_PARTIAL_SUCCEEDED,
+		nebula.ErrorCode_E_DISCONNECTED, nebula.ErrorCode_E_FAIL_TO_CONNECT:
+		return true
+	}
+	msg := strings.ToLower(nerr.Message)
+	return strings.Contains(msg, "rpc failure") ||
+		strings.Contains(msg, "rpc_failure") ||
+		strings.Contains(msg, "timeout") ||
+		strings.Contains(msg, "too many") ||
+		strings.Contains(msg, "write blocked")
+}
+
+// NebulaStore is the nebula graph store.
+type NebulaStore struct {
+	pool          *Pool
+	schemaTimeout time.Duration
+
+	// idle sessions by the space they use, "" for none. At most half of the
+	// pool connections are kept idle.
+	lk      sync.Mutex
+	idle    map[string][]*nebula.Session
+	idles   int
+	maxIdle int
+}
+
+func NewNebulaStore(pool *Pool, schemaTimeout time.Duration) *NebulaStore {
+	maxIdle := pool.conf.MaxConnPoolSize / 2
+	if maxIdle < 1 {
+		maxIdle = 1
+	}
+	return &NebulaStore{
+		pool:          pool,
+		schemaTimeout: schemaTimeout,
+		idle:          map[string][]*nebula.Session{},
+		maxIdle:       maxIdle,
+	}
+}
+
+// session returns an idle session of space and whether it uses space.
+func (s *NebulaStore) session(space string) (*nebula.Session, bool, error) {
+	s.lk.Lock()
+	if sessions := s.idle[space]; len(sessions) > 0 {
+		session := sessions[len(sessions)-1]
+		s.idle[space] = sessions[:len(sessions)-1]
+		s.idles--
+		s.lk.Unlock()
+		return session, true, nil
+	}
+	s.lk.Unlock()
+	session, err := s.pool.Session()
+	return session, false, err
+}
+
+func (s *NebulaStore) release(space string) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	for _, session := range s.idle[space] {
+		session.Release()
+	}
+	s.idles -= len(s.idle[space])
+	delete(s.idle, space)
+}
+
+// execute runs sql in space, or outside of any space when space is empty.
+func (s *NebulaStore) execute(space string, sql string) (*nebula.ResultSet, error) {
+	session, used, err := s.session(space)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotSent, err)
+	}
+	if space != "" && !used {
+		sql = fmt.Sprintf("USE %s;", QuoteIdent(space)) + sql
+	}
+	resultSet, err := session.Execute(sql)
+	if err != nil {
+		session.Release()
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	if !resultSet.IsSucceed() {
+		// the session may be left outside of space.
+		session.Release()
+		return nil, &nebulaError{
+			Code:    resultSet.GetErrorCode(),
+			Message: resultSet.GetErrorMsg(),
+			Sql:     sql,
+		}
+	}
+	s.put(space, session)
+	return resultSet, nil
+}
+
+// put keeps session idle for space, it's released beyond the idle limits.
+func (s *NebulaStore) put(space string, session *nebula.Session) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	if len(s.idle[space]) >= idleSessionsPerSpace || s.idles >= s.maxIdle {
+		session.Release()
+		return
+	}
+	s.idle[space] = append(s.idle[space], session)
+	s.idles++
+}
+
+// executeSchemaRetry runs sql, retrying with backoff while it fails on a
+// schema which is not propagated yet, up to the schema timeout.
+func (s *NebulaStore) executeSchemaRetry(space string, sql string) error {
+	deadline := time.Now().Add(s.schemaTimeout)
+	backoff := schemaBackoffMin
+	for {
+		_, err := s.execute(space, sql)
+		if err == nil || !isSchemaNotFound(err) || time.Now().After(deadline) {
+			return err
+		}
+		log.WithFields(logrus.Fields{
+			"space":   space,
+			"error":   err,
+			"backoff": backoff,
+		}).Warn("nebula schema not found, retry.")
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > schemaBackoffMax {
+			backoff = schemaBackoffMax
+		}
+	}
+}
+
+// schemaDescribes returns statements that succeed once the tags, edges and
+// indexes created by stmts are visible.
+func schemaDescribes(stmts []*Statement) []string {
+	describes := []string{}
+	for _, stmt := range stmts {
+		switch stmt.Kind {
+		case StatementCreateTag, StatementCreateEdge:
+			describes = append(describes, fmt.Sprintf("DESCRIBE %s %s;", stmt.Kind[len("CREATE "):], QuoteIdent(stmt.Name)))
+		case StatementCreateTagIndex, StatementCreateEdgeIndex:
+			describes = append(describes, fmt.Sprintf("DESCRIBE %s %s;", stmt.Kind[len("CREATE "):], QuoteIdent(stmt.Index)))
+		}
+	}
+	return describes
+}
+
+// waitSchema polls nebula until the describes succeed in space, or outside
+// of any space when space is empty, or the schema timeout is reached.
+func (s *NebulaStore) waitSchema(space string, describes []string) error {
+	deadline := time.Now().Add(s.schemaTimeout)
+	for _, describe := range describes {
+		backoff := schemaBackoffMin
+		for {
+			_, err := s.execute(space, describe)
+			if err == nil {
+				break
+			}
+			if time.Now().After(deadline) {
+				return xerrors.Errorf("schema not visible after %s: %w", s.schemaTimeout, err)
+			}
+			log.WithFields(logrus.Fields{
+				"space":   space,
+				"sql":     describe,
+				"backoff": backoff,
+			}).Debug("wait for nebula schema.")
+			time.Sleep(backoff)
+			if backoff *= 2; backoff > schemaBackoffMax {
+				backoff = schemaBackoffMax
+			}
+		}
+	}
+	return nil
+}
+
+// applySchema executes stmts at once, or each alone on redo where schemas
+// already created are tolerated. Statements marked IF NOT EXISTS without
+// nebula syntax for it, eg: full-text indexes, run alone and tolerated too.
+func (s *NebulaStore) applySchema(space string, stmts []*Statement, redo bool) error {
+	type schemaSQL struct {
+		sql      string
+		tolerate bool
+	}
+	sqls := []schemaSQL{}
+	batch := []*Statement{}
+	for _, stmt := range stmts {
+		if !redo && !(stmt.IfNotExists && stmt.Kind == StatementOther) {
+			batch = append(batch, stmt)
+			continue
+		}
+		if len(batch) > 0 {
+			sqls = append(sqls, schemaSQL{sql: Render(batch)})
+			batch = nil
+		}
+		sqls = append(sqls, schemaSQL{sql: Render([]*Statement{stmt}), tolerate: true})
+	}
+	if len(batch) > 0 {
+		sqls = append(sqls, schemaSQL{sql: Render(batch)})
+	}
+	for _, schema := range sqls {
+		sql := schema.sql
+		err := s.executeSchemaRetry(space, sql)
+		if schema.tolerate && isExisted(err) {
+			log.WithFields(logrus.Fields{
+				"space": space,
+				"sql":   sql,
+			}).Info("skip existed nebula schema.")
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *NebulaStore) CreateSchema(space string, stmts []*Statement, redo bool) error {
+	spaces := []*Statement{}
+	schemas := []*Statement{}
+	for _, stmt := range stmts {
+		switch stmt.Kind {
+		case StatementCreateSpace:
+			spaces = append(spaces, stmt)
+		case StatementUse:
+		default:
+			schemas = append(schemas, stmt)
+		}
+	}
+	if len(spaces) > 0 {
+		if err := s.applySchema("", spaces, redo); err != nil {
+			return err
+		}
+		if err := s.waitSchema("", []string{fmt.Sprintf("DESCRIBE SPACE %s;", QuoteIdent(space))}); err != nil {
+			return err
+		}
+	}
+	if len(schemas) == 0 {
+		return nil
+	}
+	if err := s.applySchema(space, schemas, redo); err != nil {
+		return err
+	}
+	return s.waitSchema(space, schemaDescribes(schemas))
+}
+
+// Upsert writes stmts, idempotent ones are retried while their schema is not
+// propagated. Others are not, a batch may be applied up to the failing
+// statement.
+func (s *NebulaStore) Upsert(space string, stmts []*Statement) error {
+	if len(stmts) == 0 {
+		return nil
+	}
+	if !Idempotent(stmts) {
+		_, err := s.execute(space, Render(stmts))
+		return err
+	}
+	return s.executeSchemaRetry(space, Render(stmts))
+}
+
+func (s *NebulaStore) RebuildIndex(space string, kind string) (int64, error) {
+	rs, err := s.execute(space, fmt.Sprintf("REBUILD %s INDEX;", kind))
+	if err != nil {
+		return 0, xerrors.Errorf("failed to rebuild index of space %s: %w", space, err)
+	}
+	return jobID(rs)
+}
+
+func (s *NebulaStore) SubmitStats(space string) (int64, error) {
+	rs, err := s.execute(space, "SUBMIT JOB STATS;")
+	if err != nil {
+		return 0, xerrors.Errorf("failed to submit stats of space %s: %w", space, err)
+	}
+	return jobID(rs)
+}
+
+// Stats reads SHOW STATS, rows are typed Tag, Edge or Space with the
+// vertices and edges totals.
+func (s *NebulaStore) Stats(space string) (*Stats, error) {
+	rs, err := s.execute(space, "SHOW STATS;")
+	if err != nil {
+		return nil, err
+	}
+	types, err := column(rs, 0)
+	if err != nil {
+		return nil, err
+	}
+	names, err := column(rs, 1)
+	if err != nil {
+		return nil, err
+	}
+	stats := NewStats()
+	for i := range types {
+		row, err := rs.GetRowValuesByIndex(i)
+		if err != nil {
+			return nil, err
+		}
+		value, err := row.GetValueByIndex(2)
+		if err != nil {
+			return nil, err
+		}
+		count, err := value.AsInt()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case strings.EqualFold(types[i], "Tag"):
+			stats.Tags[names[i]] = count
+		case strings.EqualFold(types[i], "Edge"):
+			stats.Edges[names[i]] = count
+		case strings.EqualFold(names[i], "vertices"):
+			stats.Vertices = count
+		case strings.EqualFold(names[i], "edges"):
+			stats.Relations = count
+		}
+	}
+	return stats, nil
+}
+
+// jobID returns the job id of a submitted job, or -1 when nebula creates
+// none.
+func jobID(rs *nebula.ResultSet) (int64, error) {
+	if rs.GetRowSize() == 0 {
+		return -1, nil
+	}
+	row, err := rs.GetRowValuesByIndex(0)
+	if err != nil {
+		return 0, err
+	}
+	value, err := row.GetValueByIndex(0)
+	if err != nil {
+		return 0, err
+	}
+	return value.AsInt()
+}
+
+func (s *NebulaStore) JobStatus(space string, job int64) (string, error) {
+	rs, err := s.execute(space, fmt.Sprintf("SHOW JOB %d;", job))
+	if err != nil {
+		return "", err
+	}
+	row, err := rs.GetRowValuesByIndex(0)
+	if err != nil {
+		return "", err
+	}
+	value, err := row.GetValueByIndex(2)
+	if err != nil {
+		return "", err
+	}
+	return value.AsString()
+}
+
+// DropSpace drops space outside of it, the sessions using it are released.
+func (s *NebulaStore) DropSpace(space string) error {
+	defer s.release(space)
+	_, err := s.execute("", fmt.Sprintf("DROP SPACE IF EXISTS %s;", QuoteIdent(space)))
+	return err
+}
+
+// column returns the string values of column col.
+func column(rs *nebula.ResultSet, col int) ([]string, error) {
+	values := []string{}
+	for i := 0; i < rs.GetRowSize(); i++ {
+		row, err := rs.GetRowValuesByIndex(i)
+		if err != nil {
+			return nil, err
+		}
+		value, err := row.GetValueByIndex(col)
+		if err != nil {
+			return nil, err
+		}
+		if !value.IsString() {
+			values = append(values, value.String())
+			continue
+		}
+		str, err := value.AsString()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, str)
+	}
+	return values, nil
+}
+
+// describeProps returns the properties of the tag or edge described by sql.
+func (s *NebulaStore) describeProps(space string, sql string) ([]*Prop, error) {
+	rs, err := s.execute(space, sql)
+	if err != nil {
+		return nil, err
+	}
+	names, err := column(rs, 0)
+	if err != nil {
+		return nil, err
+	}
+	types, err := column(rs, 1)
+	if err != nil {
+		return nil, err
+	}
+	props := make([]*Prop, 0, len(names))
+	for i, name := range names {
+		props = append(props, &Prop{Name: name, Type: NormalizeType(types[i])})
+	}
+	return props, nil
+}
+
+// Schema describes the tags, edges and indexes listed by nebula.
+func (s *NebulaStore) Schema(space string) (*Schema, error) {
+	schema := NewSchema()
+	for _, kind := range []string{"TAG", "EDGE"} {
+		rs, err := s.execute(space, fmt.Sprintf("SHOW %sS;", kind))
+		if err != nil {
+			return nil, err
+		}
+		names, err := column(rs, 0)
+		if err != nil {
+			return nil, err
+		}
+		schemas := schema.Tags
+		if kind == "EDGE" {
+			schemas = schema.Edges
+		}
+		for _, name := range names {
+			props, err := s.describeProps(space, fmt.Sprintf("DESCRIBE %s %s;", kind, QuoteIdent(name)))
+			if err != nil {
+				return nil, err
+			}
+			schemas[name] = props
+		}
+
+		rs, err = s.execute(space, fmt.Sprintf("SHOW %s INDEXES;", kind))
+		if err != nil {
+			return nil, err
+		}
+		indexes, err := column(rs, 0)
+		if err != nil {
+			return nil, err
+		}
+		// the indexed tag or edge, listed since nebula 2.5.
+		targets := make([]string, len(indexes))
+		if rs.GetColSize() > 1 {
+			if targets, err = column(rs, 1); err != nil {
+				return nil, err
+			}
+		}
+		for i, name := range indexes {
+			fields, err := s.describeProps(space, fmt.Sprintf("DESCRIBE %s INDEX %s;", kind, QuoteIdent(name)))
+			if err != nil {
+				return nil, err
+			}
+			index := &Index{Schema: strings.ToLower(kind), Name: targets[i], Props: []string{}}
+			for _, field := range fields {
+				index.Props = append(index.Props, field.Name)
+			}
+			schema.Indexes[name] = index
+		}
+	}
+	return schema, nil
+}
+
+// Query runs sql on a new session, its USE statements don't leak.
+func (s *NebulaStore) Query(sql string) ([]Result, error) {
+	session, err := s.pool.Session()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Release()
+
+	resultSet, err := session.ExecuteJson(sql)
+	if err != nil {
+		return nil, err
+	}
+
+	var jsonObj ResultSet
+	// Parse JSON
+	json.Unmarshal(resultSet, &jsonObj)
+
+	for _, resultErr := range jsonObj.Errors {
+		if resultErr.Code != 0 {
+			return nil, xerrors.Errorf("nebula execute error sql:%s, code:%d, message:%s", sql, resultErr.Code, resultErr.Message)
+		}
+	}
+
+	log.WithFields(logrus.Fields{
+		"sql":    sql,
+		"result": jsonObj,
+	}).Info("nebula query")
+
+	return jsonObj.Results, nil
+}
+
+// Export matches the vertices of every tag and walks their one step
+// subgraphs.
+func (s *NebulaStore) Export(space string, vertex func(*Vertex) error, edge func(*Edge) error) error {
+	use := fmt.Sprintf("USE %s;", QuoteIdent(space))
+	results, err := s.Query(use + "SHOW TAGS;")
+	if err != nil {
+		return err
+	}
+
+	tags := []string{}
+	for _, rdata := range results {
+		for _, data := range rdata.Data {
+			for _, row := range data.Row {
+				tags = append(tags, row.(string))
+			}
+		}
+	}
+
+	ids := []string{}
+	for _, tag := range tags {
+		results, err := s.Query(fmt.Sprintf("%sMATCH (v:%s) RETURN v;", use, QuoteIdent(tag)))
+		if err != nil {
+			return err
+		}
+		for _, rdata := range results {
+			for _, data := range rdata.Data {
+				for _, dmeta := range data.Meta {
+					meta := dmeta.(map[string]interface{})
+					id := meta["id"].(string)
+					ids = append(ids, id)
+				}
+			}
+		}
+	}
+
+	for _, id := range ids {
+		results, err := s.Query(fmt.Sprintf("%sGET SUBGRAPH WITH PROP 1 STEPS FROM %q;", use, id))
+		if err != nil {
+			return err
+		}
+		for _, rdata := range results {
+			for _, data := range rdata.Data {
+				for idx, dmeta := range data.Meta {
+					ameta := dmeta.([]interface{})
+					for iidex, imeta := range ameta {
+						meta := imeta.(map[string]interface{})
+						irow := data.Row[idx].([]interface{})
+						drow := irow[iidex].(map[string]interface{})
+						switch meta["type"].(string) {
+						case "vertex":
+							if err := vertex(&Vertex{ID: meta["id"].(string), Props: drow}); err != nil {
+								return err
+							}
+						case "edge":
+							id := meta["id"].(map[string]interface{})
+							err := edge(&Edge{
+								Type:  int64(id["type"].(float64)),
+								Src:   id["src"].(string),
+								Dst:   id["dst"].(string),
+								Rank:  int64(id["ranking"].(float64)),
+								Name:  id["name"].(string),
+								Props: drow,
+							})
+							if err != nil {
+								return err
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (s *NebulaStore) Health() []*HostHealth {
+	return s.pool.Check()
+}
+
+func (s *NebulaStore) Start() {
+	s.pool.Start()
+}
+
+func (s *NebulaStore) Close() {
+	s.lk.Lock()
+	spaces := make([]string, 0, len(s.idle))
+	for space := range s.idle {
+		spaces = append(spaces, space)
+	}
+	s.lk.Unlock()
+	for _, space := range spaces {
+		s.release(space)
+	}
+	s.pool.Close()
+}
@@ -0,0 +1,66 @@
+package graph
+
+import (
+	"testing"
+
+	nebula "github.com/vesoft-inc/nebula-go/v2"
+	types "github.com/vesoft-inc/nebula-go/v2/nebula"
+	"golang.org/x/xerrors"
+)
+
+func TestIsSchemaNotFound(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&nebulaError{Code: nebula.ErrorCode(types.ErrorCode_E_TAG_NOT_FOUND), Message: "TagNotFound"}, true},
+		{xerrors.Errorf("batch: %w", &nebulaError{Code: nebula.ErrorCode(types.ErrorCode_E_SPACE_NOT_FOUND)}), true},
+		// a missing vertex of an upsert condition is no schema lag.
+		{&nebulaError{Code: nebula.ErrorCode_E_SEMANTIC_ERROR, Message: "vertex not found"}, false},
+		{&nebulaError{Code: nebula.ErrorCode_E_EXECUTION_ERROR, Message: "No schema found for `t'"}, false},
+		{xerrors.New("not found"), false},
+	}
+	for _, tt := range tests {
+		if got := isSchemaNotFound(tt.err); got != tt.want {
+			t.Errorf("%v: got %v", tt.err, got)
+		}
+	}
+}
+
+func TestIdempotent(t *testing.T) {
+	tests := map[string]bool{
+		`CREATE TAG t(v string);INSERT VERTEX t(v) VALUES "a":("A")`:                   true,
+		`INSERT EDGE e(w) VALUES "a"->"b":(1);UPSERT EDGE ON e "a"->"b" SET w = w + 1`: false,
+		`UPSERT VERTEX ON t "a" SET v = "B"`:                                           false,
+	}
+	for sql, want := range tests {
+		stmts, err := ParseNGQL(sql)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := Idempotent(stmts); got != want {
+			t.Errorf("%s: got %v", sql, got)
+		}
+	}
+}
+
+func TestNotApplied(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{xerrors.Errorf("no session: %w", ErrNotSent), true},
+		{&nebulaError{Code: nebula.ErrorCode_E_SEMANTIC_ERROR, Message: "vertex not found"}, true},
+		{&nebulaError{Code: nebula.ErrorCode_E_SYNTAX_ERROR}, true},
+		{xerrors.Errorf("connection reset: %w", ErrUnavailable), false},
+		{&nebulaError{Code: nebula.ErrorCode_E_EXECUTION_ERROR, Message: "Storage Error: leader has changed"}, false},
+		{&nebulaError{Code: nebula.ErrorCode_E_EXECUTION_ERROR, Message: "Storage Error: RPC failure"}, false},
+		{&nebulaError{Code: nebula.ErrorCode_E_PARTIAL_SUCCEEDED}, false},
+		{xerrors.New("crash"), false},
+	}
+	for _, tt := range tests {
+		if got := NotApplied(tt.err); got != tt.want {
+			t.Errorf("%v: got %v", tt.err, got)
+		}
+	}
+}
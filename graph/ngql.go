@@ -0,0 +1,819 @@
+package graph
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/xerrors"
+)
+
+type tokenKind int
+
+const (
+	// bare identifier or keyword.
+	tokenIdent tokenKind = iota
+	// identifier wrapped by backticks.
+	tokenQuotedIdent
+	tokenString
+	tokenNumber
+	tokenPunct
+)
+
+type token struct {
+	kind  tokenKind
+	text  string
+	start int
+	end   int
+
+	// set by the parser when the token names a space, tag, edge, index or property.
+	name bool
+}
+
+func (t token) is(punct string) bool {
+	return t.kind == tokenPunct && t.text == punct
+}
+
+func (t token) keyword(kw string) bool {
+	return t.kind == tokenIdent && strings.EqualFold(t.text, kw)
+}
+
+// unquoted returns the identifier without backticks.
+func (t token) unquoted() string {
+	if t.kind == tokenQuotedIdent {
+		return strings.ReplaceAll(t.text[1:len(t.text)-1], "\\`", "`")
+	}
+	return t.text
+}
+
+func isIdentStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
+
+func isIdentPart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// lexNGQL splits sql into tokens, comments and spaces are dropped.
+func lexNGQL(sql string) ([]token, error) {
+	tokens := []token{}
+	runes := []rune(sql)
+	// byte offsets of runes.
+	offsets := make([]int, len(runes)+1)
+	offset := 0
+	for i, r := range runes {
+		offsets[i] = offset
+		offset += len(string(r))
+	}
+	offsets[len(runes)] = offset
+
+	emit := func(kind tokenKind, start, end int) {
+		tokens = append(tokens, token{
+			kind:  kind,
+			text:  sql[offsets[start]:offsets[end]],
+			start: offsets[start],
+			end:   offsets[end],
+		})
+	}
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '#' || (r == '/' && i+1 < len(runes) && runes[i+1] == '/') || (r == '-' && i+1 < len(runes) && runes[i+1] == '-'):
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			start := i
+			for i += 2; i+1 < len(runes) && !(runes[i] == '*' && runes[i+1] == '/'); i++ {
+			}
+			if i+1 >= len(runes) {
+				return nil, xerrors.Errorf("unterminated comment at %d", offsets[start])
+			}
+			i += 2
+		case r == '\'' || r == '"' || r == '`':
+			start := i
+			i++
+			for ; i < len(runes) && runes[i] != r; i++ {
+				if runes[i] == '\\' {
+					i++
+				}
+			}
+			if i >= len(runes) {
+				return nil, xerrors.Errorf("unterminated %c at %d", r, offsets[start])
+			}
+			i++
+			if r == '`' {
+				emit(tokenQuotedIdent, start, i)
+			} else {
+				emit(tokenString, start, i)
+			}
+		case isIdentStart(r):
+			start := i
+			for i < len(runes) && isIdentPart(runes[i]) {
+				i++
+			}
+			emit(tokenIdent, start, i)
+		case unicode.IsDigit(r):
+			start := i
+			for i < len(runes) && (isIdentPart(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			emit(tokenNumber, start, i)
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '>':
+			emit(tokenPunct, i, i+2)
+			i += 2
+		default:
+			emit(tokenPunct, i, i+1)
+			i++
+		}
+	}
+	return tokens, nil
+}
+
+type StatementKind string
+
+const (
+	StatementCreateSpace     StatementKind = "CREATE SPACE"
+	StatementCreateTag       StatementKind = "CREATE TAG"
+	StatementCreateEdge      StatementKind = "CREATE EDGE"
+	StatementCreateTagIndex  StatementKind = "CREATE TAG INDEX"
+	StatementCreateEdgeIndex StatementKind = "CREATE EDGE INDEX"
+	StatementInsertVertex    StatementKind = "INSERT VERTEX"
+	StatementInsertEdge      StatementKind = "INSERT EDGE"
+	StatementUpsertVertex    StatementKind = "UPSERT VERTEX"
+	StatementUpsertEdge      StatementKind = "UPSERT EDGE"
+	StatementUse             StatementKind = "USE"
+	StatementOther           StatementKind = "OTHER"
+)
+
+// Statement is a parsed nGQL statement.
+type Statement struct {
+	Kind StatementKind
+	// leading keywords, eg: "DROP SPACE" of a statement of kind other.
+	Verb string
+
+	// space of CREATE SPACE and USE.
+	Space string
+	// created tag, edge or index, target of an index, insert or upsert.
+	Name  string
+	Index string
+	// tags of INSERT VERTEX, there could be more than one.
+	Tags []string
+	// properties by tag or edge.
+	Props map[string][]string
+	// types of the properties of a created tag or edge.
+	Types []string
+	// IF NOT EXISTS of a create or insert.
+	IfNotExists bool
+	// values of an insert, or the key and SET values of an upsert.
+	Rows []*Row
+	// source after the names of the properties of a created tag or edge, eg:
+	// "string NOT NULL", or of the fields of an index, eg: "(10)".
+	Defs []string
+	// source after the properties of a create or the SET of an upsert, eg:
+	// "TTL_DURATION = 100" or "WHEN age > 10".
+	Tail string
+
+	noOverwrite bool
+	// the statement is rendered from its fields once edited.
+	edited bool
+	sql    string
+	tokens []token
+}
+
+// Row is a vertex or edge written by an insert or upsert, values are nGQL
+// expressions in the order of the properties.
+type Row struct {
+	// vertex id, or source and destination of an edge.
+	ID     string
+	Src    string
+	Dst    string
+	Rank   int64
+	Values []string
+}
+
+// Idempotent reports whether stmts can be executed twice, schemas created
+// twice are tolerated on redo, upserts may compute from current values.
+func Idempotent(stmts []*Statement) bool {
+	for _, stmt := range stmts {
+		if stmt.Kind == StatementUpsertVertex || stmt.Kind == StatementUpsertEdge {
+			return false
+		}
+	}
+	return true
+}
+
+// IsInsert reports whether the statement only writes vertices or edges.
+func (s *Statement) IsInsert() bool {
+	switch s.Kind {
+	case StatementInsertVertex, StatementInsertEdge, StatementUpsertVertex, StatementUpsertEdge:
+		return true
+	}
+	return false
+}
+
+// IsSchema reports whether the statement creates a space, tag, edge or index.
+func (s *Statement) IsSchema() bool {
+	switch s.Kind {
+	case StatementCreateSpace, StatementCreateTag, StatementCreateEdge, StatementCreateTagIndex, StatementCreateEdgeIndex:
+		return true
+	}
+	return false
+}
+
+// HasPipe reports whether the statement pipes into another one.
+func (s *Statement) HasPipe() bool {
+	for _, tok := range s.tokens {
+		if tok.is("|") {
+			return true
+		}
+	}
+	return false
+}
+
+// Unquoted returns the bare names of the statement which need backticks,
+// String quotes them.
+func (s *Statement) Unquoted() []string {
+	names := []string{}
+	for _, tok := range s.tokens {
+		if tok.name && tok.kind == tokenIdent && QuoteIdent(tok.text) != tok.text {
+			names = append(names, tok.text)
+		}
+	}
+	return names
+}
+
+// String returns the statement with reserved identifiers quoted by
+// backticks, literals are left untouched.
+func (s *Statement) String() string {
+	if s.edited {
+		return s.format()
+	}
+	var b strings.Builder
+	prev := -1
+	for _, tok := range s.tokens {
+		if prev >= 0 {
+			b.WriteString(s.sql[prev:tok.start])
+		}
+		prev = tok.end
+		if tok.name && tok.kind == tokenIdent {
+			b.WriteString(QuoteIdent(tok.text))
+		} else {
+			b.WriteString(tok.text)
+		}
+	}
+	return b.String()
+}
+
+// RenameSpace renders a CREATE SPACE or USE statement on space, the parsed
+// Space is kept.
+func (s *Statement) RenameSpace(space string) {
+	for i, tok := range s.tokens {
+		if tok.name {
+			s.tokens[i].kind = tokenIdent
+			s.tokens[i].text = space
+			return
+		}
+	}
+}
+
+var ReservedFields = []string{"GO", "AS", "TO", "OR", "AND", "XOR", "USE", "SET", "FROM", "WHERE", "MATCH", "INSERT", "YIELD", "RETURN", "DESCRIBE", "DESC", "VERTEX", "VERTICES", "EDGE", "EDGES", "UPDATE", "UPSERT", "WHEN", "DELETE", "FIND", "LOOKUP", "ALTER", "STEPS", "STEP", "OVER", "UPTO", "REVERSELY", "INDEX", "INDEXES", "REBUILD", "BOOL", "INT8", "INT16", "INT32", "INT64", "INT", "FLOAT", "DOUBLE", "STRING", "FIXED_STRING", "TIMESTAMP", "DATE", "TIME", "DATETIME", "TAG", "TAGS", "UNION", "INTERSECT", "MINUS", "NO", "OVERWRITE", "SHOW", "ADD", "CREATE", "DROP", "REMOVE", "IF", "NOT", "EXISTS", "WITH", "CHANGE", "GRANT", "REVOKE", "ON", "BY", "IN", "NOT_IN", "DOWNLOAD", "GET", "OF", "ORDER", "INGEST", "COMPACT", "FLUSH", "SUBMIT", "ASC", "ASCENDING", "DESCENDING", "DISTINCT", "FETCH", "PROP", "BALANCE", "STOP", "LIMIT", "OFFSET", "IS", "NULL", "RECOVER", "EXPLAIN", "PROFILE", "FORMAT", "CASE"}
+
+var reservedWords = func() map[string]bool {
+	words := make(map[string]bool, len(ReservedFields))
+	for _, field := range ReservedFields {
+		words[field] = true
+	}
+	return words
+}()
+
+func isReservedWord(name string) bool {
+	return reservedWords[strings.ToUpper(name)]
+}
+
+func isPlainIdent(name string) bool {
+	for i, r := range name {
+		if (i == 0 && !isIdentStart(r)) || !isIdentPart(r) {
+			return false
+		}
+	}
+	return name != ""
+}
+
+// QuoteIdent wraps name by backticks when it is a reserved word or not a
+// plain identifier.
+func QuoteIdent(name string) string {
+	if isReservedWord(name) || !isPlainIdent(name) {
+		return "`" + strings.ReplaceAll(name, "`", "\\`") + "`"
+	}
+	return name
+}
+
+// ParseNGQL parses the statements of sql separated by semicolons.
+func ParseNGQL(sql string) ([]*Statement, error) {
+	tokens, err := lexNGQL(sql)
+	if err != nil {
+		return nil, err
+	}
+	stmts := []*Statement{}
+	start := 0
+	for i := 0; i <= len(tokens); i++ {
+		if i < len(tokens) && !tokens[i].is(";") {
+			continue
+		}
+		if i > start {
+			stmt, err := parseStatement(sql, tokens[start:i])
+			if err != nil {
+				return nil, err
+			}
+			stmts = append(stmts, stmt)
+		}
+		start = i + 1
+	}
+	return stmts, nil
+}
+
+type ngqlParser struct {
+	sql    string
+	tokens []token
+	pos    int
+}
+
+func (p *ngqlParser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *ngqlParser) peek() token {
+	if p.done() {
+		return token{kind: tokenPunct, start: len(p.sql), end: len(p.sql)}
+	}
+	return p.tokens[p.pos]
+}
+
+// accept consumes the keywords when all of them follow.
+func (p *ngqlParser) accept(kws ...string) bool {
+	if p.pos+len(kws) > len(p.tokens) {
+		return false
+	}
+	for i, kw := range kws {
+		if !p.tokens[p.pos+i].keyword(kw) {
+			return false
+		}
+	}
+	p.pos += len(kws)
+	return true
+}
+
+func (p *ngqlParser) expect(punct string) error {
+	if !p.peek().is(punct) {
+		return p.errorf("expect %q", punct)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *ngqlParser) errorf(format string, args ...interface{}) error {
+	tok := p.peek()
+	return xerrors.Errorf("%s at %d near %q", fmt.Sprintf(format, args...), tok.start, tok.text)
+}
+
+// name consumes an identifier and marks it as a name.
+func (p *ngqlParser) name() (string, error) {
+	tok := p.peek()
+	if tok.kind != tokenIdent && tok.kind != tokenQuotedIdent {
+		return "", p.errorf("expect identifier")
+	}
+	p.tokens[p.pos].name = true
+	p.pos++
+	return tok.unquoted(), nil
+}
+
+// skipTo advances to the next top level token matching one of puncts or
+// keywords, or to the end of the group closing the current depth.
+func (p *ngqlParser) skipTo(puncts []string, kws []string) {
+	depth := 0
+	for ; !p.done(); p.pos++ {
+		tok := p.peek()
+		if depth == 0 {
+			for _, punct := range puncts {
+				if tok.is(punct) {
+					return
+				}
+			}
+			for _, kw := range kws {
+				if tok.keyword(kw) {
+					return
+				}
+			}
+		}
+		switch {
+		case tok.is("(") || tok.is("[") || tok.is("{"):
+			depth++
+		case tok.is(")") || tok.is("]") || tok.is("}"):
+			if depth == 0 {
+				return
+			}
+			depth--
+		}
+	}
+}
+
+// source returns the text of the tokens from start to the current one.
+func (p *ngqlParser) source(start int) string {
+	if p.pos <= start {
+		return ""
+	}
+	return p.sql[p.tokens[start].start:p.tokens[p.pos-1].end]
+}
+
+// rest returns the text of the tokens left.
+func (p *ngqlParser) rest() string {
+	if p.done() {
+		return ""
+	}
+	return p.sql[p.peek().start:p.tokens[len(p.tokens)-1].end]
+}
+
+// nameList parses "(name ..., name ...)", only the leading identifier of
+// each item is a name, eg: property definitions and index fields. It returns
+// the source after each name too.
+func (p *ngqlParser) nameList() ([]string, []string, error) {
+	if err := p.expect("("); err != nil {
+		return nil, nil, err
+	}
+	names, defs := []string{}, []string{}
+	for !p.peek().is(")") {
+		name, err := p.name()
+		if err != nil {
+			return nil, nil, err
+		}
+		start := p.pos
+		p.skipTo([]string{","}, nil)
+		names = append(names, name)
+		defs = append(defs, p.source(start))
+		if p.peek().is(",") {
+			p.pos++
+		}
+		if p.done() {
+			return nil, nil, p.errorf("expect \")\"")
+		}
+	}
+	p.pos++
+	return names, defs, nil
+}
+
+func parseStatement(sql string, tokens []token) (*Statement, error) {
+	p := &ngqlParser{sql: sql, tokens: tokens}
+	stmt := &Statement{
+		Kind:   StatementOther,
+		Props:  map[string][]string{},
+		sql:    sql,
+		tokens: tokens,
+	}
+
+	verbs := []string{}
+	for i := 0; i < len(tokens) && i < 2 && tokens[i].kind == tokenIdent; i++ {
+		verbs = append(verbs, strings.ToUpper(tokens[i].text))
+	}
+	stmt.Verb = strings.Join(verbs, " ")
+
+	var err error
+	switch {
+	case p.accept("CREATE", "SPACE"):
+		stmt.Kind = StatementCreateSpace
+		stmt.IfNotExists = p.accept("IF", "NOT", "EXISTS")
+		stmt.Space, err = p.name()
+		stmt.Name = stmt.Space
+	case p.accept("CREATE", "TAG", "INDEX"):
+		stmt.Kind = StatementCreateTagIndex
+		err = p.parseIndex(stmt)
+	case p.accept("CREATE", "EDGE", "INDEX"):
+		stmt.Kind = StatementCreateEdgeIndex
+		err = p.parseIndex(stmt)
+	case p.accept("CREATE", "TAG"):
+		stmt.Kind = StatementCreateTag
+		err = p.parseSchema(stmt)
+	case p.accept("CREATE", "EDGE"):
+		stmt.Kind = StatementCreateEdge
+		err = p.parseSchema(stmt)
+	case p.accept("INSERT", "VERTEX"):
+		stmt.Kind = StatementInsertVertex
+		err = p.parseInsert(stmt)
+	case p.accept("INSERT", "EDGE"):
+		stmt.Kind = StatementInsertEdge
+		err = p.parseInsert(stmt)
+	case p.accept("UPSERT", "VERTEX"):
+		stmt.Kind = StatementUpsertVertex
+		err = p.parseUpsert(stmt)
+	case p.accept("UPSERT", "EDGE"):
+		stmt.Kind = StatementUpsertEdge
+		err = p.parseUpsert(stmt)
+	case p.accept("USE"):
+		stmt.Kind = StatementUse
+		stmt.Space, err = p.name()
+		stmt.Name = stmt.Space
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("failed to parse %s: %w", stmt.Kind, err)
+	}
+	return stmt, nil
+}
+
+// parseSchema parses "[IF NOT EXISTS] name ([prop type ...], ...) ...".
+func (p *ngqlParser) parseSchema(stmt *Statement) error {
+	stmt.IfNotExists = p.accept("IF", "NOT", "EXISTS")
+	name, err := p.name()
+	if err != nil {
+		return err
+	}
+	stmt.Name = name
+	if err := p.expect("("); err != nil {
+		return err
+	}
+	props := []string{}
+	for !p.peek().is(")") {
+		prop, err := p.name()
+		if err != nil {
+			return err
+		}
+		start := p.pos
+		typ, err := p.expr([]string{","}, []string{"NULL", "NOT", "DEFAULT", "COMMENT"})
+		if err != nil {
+			return err
+		}
+		props = append(props, prop)
+		stmt.Types = append(stmt.Types, typ)
+		p.skipTo([]string{","}, nil)
+		stmt.Defs = append(stmt.Defs, p.source(start))
+		if p.peek().is(",") {
+			p.pos++
+		}
+		if p.done() {
+			return p.errorf("expect \")\"")
+		}
+	}
+	p.pos++
+	stmt.Props[name] = props
+	stmt.Tail = p.rest()
+	return nil
+}
+
+// parseIndex parses "[IF NOT EXISTS] index ON name ([prop[(len)], ...])".
+func (p *ngqlParser) parseIndex(stmt *Statement) error {
+	stmt.IfNotExists = p.accept("IF", "NOT", "EXISTS")
+	index, err := p.name()
+	if err != nil {
+		return err
+	}
+	stmt.Index = index
+	if !p.accept("ON") {
+		return p.errorf("expect ON")
+	}
+	name, err := p.name()
+	if err != nil {
+		return err
+	}
+	stmt.Name = name
+	props, defs, err := p.nameList()
+	if err != nil {
+		return err
+	}
+	stmt.Props[name] = props
+	stmt.Defs = defs
+	stmt.Tail = p.rest()
+	return nil
+}
+
+// parseInsert parses "[IF NOT EXISTS] name (props) [, name (props)] VALUES key:(values), ...".
+func (p *ngqlParser) parseInsert(stmt *Statement) error {
+	stmt.IfNotExists = p.accept("IF", "NOT", "EXISTS")
+	if !stmt.IfNotExists {
+		stmt.noOverwrite = p.accept("NO", "OVERWRITE")
+	}
+	for {
+		name, err := p.name()
+		if err != nil {
+			return err
+		}
+		props, _, err := p.nameList()
+		if err != nil {
+			return err
+		}
+		stmt.Props[name] = props
+		if stmt.Kind == StatementInsertVertex {
+			stmt.Tags = append(stmt.Tags, name)
+		}
+		if stmt.Name == "" {
+			stmt.Name = name
+		}
+		if !p.peek().is(",") {
+			break
+		}
+		p.pos++
+	}
+	if !p.accept("VALUES") {
+		return p.errorf("expect VALUES")
+	}
+	for {
+		row, err := p.rowKey(stmt, []string{":"}, nil)
+		if err != nil {
+			return err
+		}
+		if err := p.expect(":"); err != nil {
+			return err
+		}
+		if err := p.expect("("); err != nil {
+			return err
+		}
+		for !p.peek().is(")") {
+			value, err := p.expr([]string{","}, nil)
+			if err != nil {
+				return err
+			}
+			row.Values = append(row.Values, value)
+			if p.peek().is(",") {
+				p.pos++
+			}
+			if p.done() {
+				return p.errorf("expect \")\"")
+			}
+		}
+		p.pos++
+		stmt.Rows = append(stmt.Rows, row)
+		if !p.peek().is(",") {
+			return nil
+		}
+		p.pos++
+	}
+}
+
+// expr consumes the source of an expression up to the next top level token
+// matching one of puncts or keywords.
+func (p *ngqlParser) expr(puncts []string, kws []string) (string, error) {
+	start := p.pos
+	p.skipTo(puncts, kws)
+	if p.pos == start {
+		return "", p.errorf("expect expression")
+	}
+	return p.sql[p.tokens[start].start:p.tokens[p.pos-1].end], nil
+}
+
+// rowKey parses the vertex id, or "src -> dst [@rank]" of an edge, ended by
+// one of puncts or keywords.
+func (p *ngqlParser) rowKey(stmt *Statement, puncts []string, kws []string) (*Row, error) {
+	row := &Row{}
+	var err error
+	if stmt.Kind == StatementInsertVertex || stmt.Kind == StatementUpsertVertex {
+		row.ID, err = p.expr(puncts, kws)
+		return row, err
+	}
+	if row.Src, err = p.expr([]string{"->"}, nil); err != nil {
+		return nil, err
+	}
+	if err := p.expect("->"); err != nil {
+		return nil, err
+	}
+	if row.Dst, err = p.expr(append([]string{"@"}, puncts...), kws); err != nil {
+		return nil, err
+	}
+	if p.peek().is("@") {
+		p.pos++
+		rank, err := p.expr(puncts, kws)
+		if err != nil {
+			return nil, err
+		}
+		if row.Rank, err = strconv.ParseInt(rank, 10, 64); err != nil {
+			return nil, p.errorf("invalid rank %s", rank)
+		}
+	}
+	return row, nil
+}
+
+// parseUpsert parses "ON name key SET prop = expr, ... [WHEN ...] [YIELD ...]".
+func (p *ngqlParser) parseUpsert(stmt *Statement) error {
+	if !p.accept("ON") {
+		return p.errorf("expect ON")
+	}
+	name, err := p.name()
+	if err != nil {
+		return err
+	}
+	stmt.Name = name
+	if stmt.Kind == StatementUpsertVertex {
+		stmt.Tags = append(stmt.Tags, name)
+	}
+	row, err := p.rowKey(stmt, nil, []string{"SET"})
+	if err != nil {
+		return err
+	}
+	if !p.accept("SET") {
+		return p.errorf("expect SET")
+	}
+	props := []string{}
+	for !p.done() {
+		prop, err := p.name()
+		if err != nil {
+			return err
+		}
+		props = append(props, prop)
+		if err := p.expect("="); err != nil {
+			return err
+		}
+		value, err := p.expr([]string{","}, []string{"WHEN", "YIELD"})
+		if err != nil {
+			return err
+		}
+		row.Values = append(row.Values, value)
+		if !p.peek().is(",") {
+			break
+		}
+		p.pos++
+	}
+	stmt.Props[name] = props
+	stmt.Rows = []*Row{row}
+	stmt.Tail = p.rest()
+	return nil
+}
+
+// Literal returns the value of a string, number, bool or null literal, other
+// expressions are returned as their source.
+func Literal(expr string) interface{} {
+	tokens, err := lexNGQL(expr)
+	if err != nil || len(tokens) == 0 {
+		return expr
+	}
+	sign := ""
+	if len(tokens) == 2 && tokens[0].is("-") && tokens[1].kind == tokenNumber {
+		sign = "-"
+		tokens = tokens[1:]
+	}
+	if len(tokens) != 1 {
+		return expr
+	}
+	tok := tokens[0]
+	switch {
+	case tok.kind == tokenString:
+		return unescape(tok.text[1 : len(tok.text)-1])
+	case tok.kind == tokenNumber:
+		if value, err := strconv.ParseInt(sign+tok.text, 0, 64); err == nil {
+			return value
+		}
+		if value, err := strconv.ParseFloat(sign+tok.text, 64); err == nil {
+			return value
+		}
+	case tok.keyword("true"):
+		return true
+	case tok.keyword("false"):
+		return false
+	case tok.keyword("null"):
+		return nil
+	}
+	return expr
+}
+
+// StringLiteral returns the value of a string literal.
+func StringLiteral(expr string) (string, bool) {
+	tokens, err := lexNGQL(expr)
+	if err != nil || len(tokens) != 1 || tokens[0].kind != tokenString {
+		return "", false
+	}
+	return unescape(tokens[0].text[1 : len(tokens[0].text)-1]), true
+}
+
+func unescape(text string) string {
+	var b strings.Builder
+	escaped := false
+	for _, r := range text {
+		if !escaped && r == '\\' {
+			escaped = true
+			continue
+		}
+		if escaped {
+			switch r {
+			case 'n':
+				r = '\n'
+			case 't':
+				r = '\t'
+			case 'r':
+				r = '\r'
+			}
+			escaped = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Render joins stmts to execute.
+func Render(stmts []*Statement) string {
+	var b strings.Builder
+	for _, stmt := range stmts {
+		b.WriteString(stmt.String())
+		b.WriteString(";")
+	}
+	return b.String()
+}
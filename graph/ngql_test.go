@@ -0,0 +1,208 @@
+package graph
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseNGQLKinds(t *testing.T) {
+	tests := []struct {
+		sql   string
+		kind  StatementKind
+		name  string
+		space string
+		props map[string][]string
+	}{
+		{"CREATE SPACE IF NOT EXISTS sp(vid_type=FIXED_STRING(32))", StatementCreateSpace, "sp", "sp", map[string][]string{}},
+		{"CREATE TAG person(name string, age int)", StatementCreateTag, "person", "", map[string][]string{"person": {"name", "age"}}},
+		{"CREATE EDGE IF NOT EXISTS like(likeness double)", StatementCreateEdge, "like", "", map[string][]string{"like": {"likeness"}}},
+		{"CREATE TAG INDEX person_name ON person(name(16))", StatementCreateTagIndex, "person", "", map[string][]string{"person": {"name"}}},
+		{"CREATE EDGE INDEX IF NOT EXISTS like_i ON like()", StatementCreateEdgeIndex, "like", "", map[string][]string{"like": {}}},
+		{`INSERT VERTEX person(name, age) VALUES "a":("A", 1)`, StatementInsertVertex, "person", "", map[string][]string{"person": {"name", "age"}}},
+		{`INSERT EDGE like(likeness) VALUES "a"->"b":(0.5)`, StatementInsertEdge, "like", "", map[string][]string{"like": {"likeness"}}},
+		{`UPSERT VERTEX ON person "a" SET age = age + 1`, StatementUpsertVertex, "person", "", map[string][]string{"person": {"age"}}},
+		{`UPSERT EDGE ON like "a"->"b" SET likeness = 1.0`, StatementUpsertEdge, "like", "", map[string][]string{"like": {"likeness"}}},
+		{"USE sp", StatementUse, "sp", "sp", map[string][]string{}},
+		{"DROP SPACE sp", StatementOther, "", "", map[string][]string{}},
+		{`FETCH PROP ON person "a"`, StatementOther, "", "", map[string][]string{}},
+	}
+	for _, tt := range tests {
+		stmts, err := ParseNGQL(tt.sql)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.sql, err)
+		}
+		if len(stmts) != 1 {
+			t.Fatalf("%s: %d statements", tt.sql, len(stmts))
+		}
+		stmt := stmts[0]
+		if stmt.Kind != tt.kind || stmt.Name != tt.name || stmt.Space != tt.space {
+			t.Errorf("%s: got %s %q %q", tt.sql, stmt.Kind, stmt.Name, stmt.Space)
+		}
+		if !reflect.DeepEqual(stmt.Props, tt.props) {
+			t.Errorf("%s: props %v", tt.sql, stmt.Props)
+		}
+	}
+}
+
+func TestParseNGQLErrors(t *testing.T) {
+	for _, sql := range []string{
+		`INSERT VERTEX person(name) "a":("A")`,
+		`INSERT EDGE like(l) VALUES "a":(1)`,
+		`INSERT EDGE like(l) VALUES "a"->"b"@x:(1)`,
+		`UPSERT VERTEX person "a" SET age = 1`,
+		`CREATE TAG person(name string`,
+		`INSERT VERTEX person(name) VALUES "a:("A")`,
+		`USE sp /* open`,
+	} {
+		if _, err := ParseNGQL(sql); err == nil {
+			t.Errorf("%s: parsed", sql)
+		}
+	}
+}
+
+func TestStatementString(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want string
+	}{
+		// reserved names are quoted, literals are untouched.
+		{`INSERT VERTEX tag(name, order) VALUES "order":("tag", "WHERE")`, "INSERT VERTEX `tag`(name, `order`) VALUES \"order\":(\"tag\", \"WHERE\")"},
+		{"CREATE TAG date(value string, time int)", "CREATE TAG `date`(value string, `time` int)"},
+		{`UPSERT EDGE ON edge "a"->"b" SET limit = 'limit'`, "UPSERT EDGE ON `edge` \"a\"->\"b\" SET `limit` = 'limit'"},
+		{"USE space1", "USE space1"},
+		// backtick identifiers are kept.
+		{"CREATE TAG `order`(`from` string)", "CREATE TAG `order`(`from` string)"},
+		{"CREATE TAG `my tag`(v string)", "CREATE TAG `my tag`(v string)"},
+		// trailing comments are dropped, inner ones kept as source.
+		{"USE sp # the space", "USE sp"},
+		{"USE sp // the space", "USE sp"},
+		{"USE sp -- the space", "USE sp"},
+		{"USE sp /* the space */", "USE sp"},
+		{"USE /* the space */ `order`", "USE /* the space */ `order`"},
+		{`INSERT VERTEX t(v) VALUES "a":("# not a comment")`, `INSERT VERTEX t(v) VALUES "a":("# not a comment")`},
+	}
+	for _, tt := range tests {
+		stmts, err := ParseNGQL(tt.sql)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.sql, err)
+		}
+		if got := stmts[0].String(); got != tt.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", tt.sql, got, tt.want)
+		}
+	}
+}
+
+func TestQuoteIdent(t *testing.T) {
+	tests := map[string]string{
+		"name":    "name",
+		"_name1":  "_name1",
+		"order":   "`order`",
+		"ORDER":   "`ORDER`",
+		"1name":   "`1name`",
+		"my name": "`my name`",
+		"a`b":     "`a\\`b`",
+	}
+	for name, want := range tests {
+		if got := QuoteIdent(name); got != want {
+			t.Errorf("%s: got %s, want %s", name, got, want)
+		}
+	}
+}
+
+func TestParseNGQLRows(t *testing.T) {
+	stmts, err := ParseNGQL(`INSERT EDGE like(l) VALUES "a"->"b"@3:(1), "b" -> "c":(2)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*Row{
+		{Src: `"a"`, Dst: `"b"`, Rank: 3, Values: []string{"1"}},
+		{Src: `"b"`, Dst: `"c"`, Values: []string{"2"}},
+	}
+	if !reflect.DeepEqual(stmts[0].Rows, want) {
+		t.Errorf("rows %+v %+v", stmts[0].Rows[0], stmts[0].Rows[1])
+	}
+
+	stmts, err = ParseNGQL(`INSERT VERTEX a(x), b(y, z) VALUES hash("v"):(1, 2, f(3, 4))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stmt := stmts[0]
+	if !reflect.DeepEqual(stmt.Tags, []string{"a", "b"}) || stmt.Rows[0].ID != `hash("v")` ||
+		!reflect.DeepEqual(stmt.Rows[0].Values, []string{"1", "2", "f(3, 4)"}) {
+		t.Errorf("vertex %v %+v", stmt.Tags, stmt.Rows[0])
+	}
+
+	stmts, err = ParseNGQL(`UPSERT VERTEX ON p "a" SET n = n + 1, m = "x" WHEN n > 1 YIELD n`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stmt = stmts[0]
+	if !reflect.DeepEqual(stmt.Rows[0].Values, []string{"n + 1", `"x"`}) || stmt.Tail != "WHEN n > 1 YIELD n" {
+		t.Errorf("upsert %+v %q", stmt.Rows[0], stmt.Tail)
+	}
+}
+
+func TestParseNGQLMultiStatements(t *testing.T) {
+	sql := `CREATE SPACE IF NOT EXISTS sp(vid_type=FIXED_STRING(32)); USE sp; ; CREATE TAG IF NOT EXISTS t(v string); # c; -- d
+INSERT VERTEX t(v) VALUES "a":("x;y");`
+	stmts, err := ParseNGQL(sql)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kinds := []StatementKind{}
+	for _, stmt := range stmts {
+		kinds = append(kinds, stmt.Kind)
+	}
+	want := []StatementKind{StatementCreateSpace, StatementUse, StatementCreateTag, StatementInsertVertex}
+	if !reflect.DeepEqual(kinds, want) {
+		t.Errorf("kinds %v", kinds)
+	}
+	if v := stmts[3].Rows[0].Values[0]; v != `"x;y"` {
+		t.Errorf("value %s", v)
+	}
+}
+
+func TestRenderRoundTrip(t *testing.T) {
+	for _, sql := range []string{
+		`CREATE SPACE IF NOT EXISTS sp(vid_type=FIXED_STRING(32));USE sp;`,
+		"CREATE TAG IF NOT EXISTS `order`(`from` string NOT NULL DEFAULT \"\", value int) TTL_DURATION = 100;",
+		"CREATE EDGE INDEX IF NOT EXISTS i ON `edge`(name(16), since);",
+		`INSERT VERTEX IF NOT EXISTS p(name), q(age) VALUES "a":("A", 1), "b":("B", 2);`,
+		"INSERT EDGE NO OVERWRITE `like`(l) VALUES \"a\"->\"b\"@1:(1.5);",
+		`UPSERT EDGE ON e "a"->"b"@2 SET w = w + 1 WHEN w < 10 YIELD w;`,
+		`DROP TAG p;`,
+	} {
+		stmts, err := ParseNGQL(sql)
+		if err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+		rendered := Render(stmts)
+		if rendered != sql {
+			t.Errorf("got  %s\nwant %s", rendered, sql)
+		}
+		again, err := ParseNGQL(rendered)
+		if err != nil {
+			t.Fatalf("%s: %v", rendered, err)
+		}
+		if Render(again) != rendered {
+			t.Errorf("not stable: %s", Render(again))
+		}
+		// the formatted statements parse into the same fields.
+		for i, stmt := range stmts {
+			if !stmt.IsInsert() && stmt.Kind != StatementCreateTag && stmt.Kind != StatementCreateEdgeIndex {
+				continue
+			}
+			stmt.edited = true
+			formatted, err := ParseNGQL(stmt.String())
+			if err != nil {
+				t.Fatalf("%s: %v", stmt.String(), err)
+			}
+			got := formatted[0]
+			if got.Kind != again[i].Kind || !reflect.DeepEqual(got.Props, again[i].Props) ||
+				!reflect.DeepEqual(got.Rows, again[i].Rows) || got.Tail != again[i].Tail ||
+				got.IfNotExists != again[i].IfNotExists || got.noOverwrite != again[i].noOverwrite {
+				t.Errorf("format %s\nof %s", stmt.String(), rendered)
+			}
+		}
+	}
+}
@@ -0,0 +1,337 @@
+package graph
+
+import (
+	"crypto/tls"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/EpiK-Protocol/go-epik-gateway/app/config"
+	"github.com/EpiK-Protocol/go-epik-gateway/utils"
+	"github.com/EpiK-Protocol/go-epik-gateway/utils/logging"
+	"github.com/sirupsen/logrus"
+	nebula "github.com/vesoft-inc/nebula-go/v2"
+	"golang.org/x/xerrors"
+)
+
+var (
+	log    *logrus.Logger
+	nebLog = nebula.DefaultLogger{}
+
+	// ErrNoHost is returned when no graphd host is reachable.
+	ErrNoHost = xerrors.New("no reachable nebula host")
+
+	defaultPingTimeout = 5 * time.Second
+
+	// GetSession errors of a broken connection, other errors like a wrong
+	// password or a full pool don't reset the pool.
+	connErrors = []string{
+		"failed to open transport",
+		"failed to create a net.Conn-backed Transport",
+		"transport is off",
+		"authentication fails",
+		"fail to close transport",
+	}
+)
+
+func initLog() {
+	if log == nil {
+		log = logging.Log()
+	}
+}
+
+// HostHealth is the last health check of a graphd host.
+type HostHealth struct {
+	Host    string `json:"host"`
+	Healthy bool   `json:"healthy"`
+	// the pool has connections to the host.
+	Pooled  bool   `json:"pooled"`
+	Error   string `json:"error,omitempty"`
+	Checked int64  `json:"checked"`
+}
+
+// Pool is the nebula connection pool shared by the api and the replay. It
+// connects to the reachable graphd hosts and is rebuilt once they are down.
+type Pool struct {
+	conf  config.Nebula
+	hosts []nebula.HostAddress
+	tls   *tls.Config
+
+	// serializes connecting, held while pinging the hosts.
+	connectLk sync.Mutex
+
+	lk     sync.Mutex
+	pool   *nebula.ConnectionPool
+	pooled map[string]bool
+
+	healthLk sync.Mutex
+	health   map[string]*HostHealth
+
+	quit chan struct{}
+}
+
+func NewPool(conf config.Nebula) (*Pool, error) {
+	initLog()
+	hosts, err := parseHosts(conf)
+	if err != nil {
+		return nil, err
+	}
+	p := &Pool{
+		conf:   conf,
+		hosts:  hosts,
+		pooled: map[string]bool{},
+		health: map[string]*HostHealth{},
+	}
+	if conf.TLS.Enable {
+		tlsConf, err := utils.TLSConfig(conf.TLS.CAFile, conf.TLS.CertFile, conf.TLS.KeyFile, conf.TLS.InsecureSkipVerify)
+		if err != nil {
+			return nil, xerrors.Errorf("nebula tls: %w", err)
+		}
+		tlsConf.ServerName = conf.TLS.ServerName
+		p.tls = tlsConf
+	}
+	return p, nil
+}
+
+// parseHosts returns the graphd hosts, address and port without hosts.
+func parseHosts(conf config.Nebula) ([]nebula.HostAddress, error) {
+	if len(conf.Hosts) == 0 {
+		if conf.Address == "" {
+			return []nebula.HostAddress{}, nil
+		}
+		return []nebula.HostAddress{{Host: conf.Address, Port: conf.Port}}, nil
+	}
+	hosts := make([]nebula.HostAddress, 0, len(conf.Hosts))
+	for _, h := range conf.Hosts {
+		host, port, err := net.SplitHostPort(h)
+		if err != nil {
+			return nil, xerrors.Errorf("nebula host %s: %w", h, err)
+		}
+		p, err := strconv.Atoi(port)
+		if err != nil {
+			return nil, xerrors.Errorf("nebula host %s: %w", h, err)
+		}
+		hosts = append(hosts, nebula.HostAddress{Host: host, Port: p})
+	}
+	return hosts, nil
+}
+
+func hostString(host nebula.HostAddress) string {
+	return net.JoinHostPort(host.Host, strconv.Itoa(host.Port))
+}
+
+// Session returns a new session of the configured user, the caller releases
+// it.
+func (p *Pool) Session() (*nebula.Session, error) {
+	pool, err := p.connect()
+	if err != nil {
+		return nil, err
+	}
+	session, err := pool.GetSession(p.conf.UserName, p.conf.Password)
+	if err != nil {
+		if isConnError(err) {
+			// reconnect on the next session.
+			p.reset(pool)
+		}
+		return nil, err
+	}
+	return session, nil
+}
+
+func isConnError(err error) bool {
+	for _, msg := range connErrors {
+		if strings.Contains(err.Error(), msg) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Pool) current() *nebula.ConnectionPool {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	return p.pool
+}
+
+func (p *Pool) connect() (*nebula.ConnectionPool, error) {
+	if pool := p.current(); pool != nil {
+		return pool, nil
+	}
+	p.connectLk.Lock()
+	defer p.connectLk.Unlock()
+	// connected while waiting.
+	if pool := p.current(); pool != nil {
+		return pool, nil
+	}
+
+	hosts := []nebula.HostAddress{}
+	for i, health := range p.check() {
+		if health.Healthy {
+			hosts = append(hosts, p.hosts[i])
+		}
+	}
+	if len(hosts) == 0 {
+		return nil, ErrNoHost
+	}
+	poolConf := nebula.GetDefaultConf()
+	poolConf.TimeOut = p.conf.Timeout
+	poolConf.IdleTime = p.conf.IdleTime
+	poolConf.MaxConnPoolSize = p.conf.MaxConnPoolSize
+	poolConf.MinConnPoolSize = p.conf.MinConnPoolSize
+	pool, err := nebula.NewSslConnectionPool(hosts, poolConf, p.tls, nebLog)
+	if err != nil {
+		return nil, err
+	}
+	pooled := map[string]bool{}
+	for _, host := range hosts {
+		pooled[hostString(host)] = true
+	}
+	p.lk.Lock()
+	p.pool = pool
+	p.pooled = pooled
+	p.lk.Unlock()
+	log.WithFields(logrus.Fields{
+		"hosts": pooled,
+		"tls":   p.tls != nil,
+	}).Info("connect nebula pool.")
+	return pool, nil
+}
+
+// reset closes pool if it's still the current one.
+func (p *Pool) reset(pool *nebula.ConnectionPool) {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	if p.pool == nil || p.pool != pool {
+		return
+	}
+	p.pool.Close()
+	p.pool = nil
+	p.pooled = map[string]bool{}
+	log.Warn("reset nebula pool.")
+}
+
+func (p *Pool) ping(host nebula.HostAddress) error {
+	timeout := p.conf.Timeout
+	if timeout <= 0 || timeout > defaultPingTimeout {
+		timeout = defaultPingTimeout
+	}
+	dialer := &net.Dialer{Timeout: timeout}
+	var (
+		conn net.Conn
+		err  error
+	)
+	if p.tls != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", hostString(host), p.tls)
+	} else {
+		conn, err = dialer.Dial("tcp", hostString(host))
+	}
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// check pings the graphd hosts.
+func (p *Pool) check() []*HostHealth {
+	results := make([]*HostHealth, len(p.hosts))
+	var wg sync.WaitGroup
+	for i, host := range p.hosts {
+		wg.Add(1)
+		go func(i int, host nebula.HostAddress) {
+			defer wg.Done()
+			health := &HostHealth{Host: hostString(host), Healthy: true, Checked: time.Now().Unix()}
+			if err := p.ping(host); err != nil {
+				health.Healthy = false
+				health.Error = err.Error()
+			}
+			results[i] = health
+		}(i, host)
+	}
+	wg.Wait()
+
+	p.healthLk.Lock()
+	defer p.healthLk.Unlock()
+	for _, health := range results {
+		if last, ok := p.health[health.Host]; ok && last.Healthy != health.Healthy {
+			log.WithFields(logrus.Fields{
+				"host":    health.Host,
+				"healthy": health.Healthy,
+				"error":   health.Error,
+			}).Warn("nebula host health changed.")
+		}
+		p.health[health.Host] = health
+	}
+	return results
+}
+
+// Check pings the graphd hosts, the pool is reset when none of its hosts is
+// healthy.
+func (p *Pool) Check() []*HostHealth {
+	results := p.check()
+	p.lk.Lock()
+	pool := p.pool
+	alive := false
+	for _, health := range results {
+		health.Pooled = p.pooled[health.Host]
+		alive = alive || (health.Pooled && health.Healthy)
+	}
+	p.lk.Unlock()
+	if pool != nil && !alive {
+		p.reset(pool)
+	}
+	return results
+}
+
+// Health returns the last health checks of the graphd hosts.
+func (p *Pool) Health() []*HostHealth {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	p.healthLk.Lock()
+	defer p.healthLk.Unlock()
+	results := make([]*HostHealth, 0, len(p.hosts))
+	for _, host := range p.hosts {
+		health, ok := p.health[hostString(host)]
+		if !ok {
+			health = &HostHealth{Host: hostString(host)}
+		}
+		h := *health
+		h.Pooled = p.pooled[h.Host]
+		results = append(results, &h)
+	}
+	return results
+}
+
+// Start checks the graphd hosts every health interval until Close.
+func (p *Pool) Start() {
+	if p.conf.HealthInterval <= 0 {
+		return
+	}
+	p.quit = make(chan struct{})
+	go func(quit chan struct{}) {
+		ticker := time.NewTicker(p.conf.HealthInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-quit:
+				return
+			case <-ticker.C:
+				p.Check()
+			}
+		}
+	}(p.quit)
+}
+
+func (p *Pool) Close() {
+	if p.quit != nil {
+		close(p.quit)
+		p.quit = nil
+	}
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	if p.pool != nil {
+		p.pool.Close()
+		p.pool = nil
+	}
+}
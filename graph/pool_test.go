@@ -0,0 +1,23 @@
+package graph
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestIsConnError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{fmt.Errorf("failed to open transport, error: dial tcp: connection refused"), true},
+		{fmt.Errorf("authentication fails, EOF"), true},
+		{fmt.Errorf("fail to authenticate, error: Bad username/password"), false},
+		{fmt.Errorf("failed to get connection: No valid connection in the idle queue and connection number has reached the pool capacity"), false},
+	}
+	for _, tt := range tests {
+		if got := isConnError(tt.err); got != tt.want {
+			t.Errorf("%v: got %v", tt.err, got)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package graph
+
+import (
+	"sort"
+	"strings"
+)
+
+const (
+	SchemaTag   = "tag"
+	SchemaEdge  = "edge"
+	SchemaIndex = "index"
+
+	// the registered schema is missing in the store.
+	DriftMissing = "missing"
+	// the store has a schema which is not registered.
+	DriftUnregistered = "unregistered"
+	// the property types differ.
+	DriftType = "type"
+)
+
+// Prop is a property of a tag or edge.
+type Prop struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// Index is a tag or edge index.
+type Index struct {
+	// tag or edge.
+	Schema string   `json:"schema"`
+	Name   string   `json:"name"`
+	Props  []string `json:"props"`
+}
+
+// Schema is the tags, edges and indexes of a space.
+type Schema struct {
+	Tags    map[string][]*Prop `json:"tags"`
+	Edges   map[string][]*Prop `json:"edges"`
+	Indexes map[string]*Index  `json:"indexes"`
+}
+
+func NewSchema() *Schema {
+	return &Schema{
+		Tags:    map[string][]*Prop{},
+		Edges:   map[string][]*Prop{},
+		Indexes: map[string]*Index{},
+	}
+}
+
+// SchemaDrift is a difference between a registered and a live schema.
+type SchemaDrift struct {
+	Schema     string `json:"schema"`
+	Name       string `json:"name"`
+	Prop       string `json:"prop,omitempty"`
+	Drift      string `json:"drift"`
+	Registered string `json:"registered,omitempty"`
+	Live       string `json:"live,omitempty"`
+}
+
+// NormalizeType returns the type as nebula describes it, eg: "int" is
+// "int64".
+func NormalizeType(typ string) string {
+	typ = strings.ToLower(strings.Join(strings.Fields(typ), ""))
+	if typ == "int" {
+		return "int64"
+	}
+	return typ
+}
+
+// Apply adds the tags, edges and indexes created by stmt, existing ones are
+// kept as nebula does. It returns whether the schema changed.
+func (s *Schema) Apply(stmt *Statement) bool {
+	switch stmt.Kind {
+	case StatementCreateTag, StatementCreateEdge:
+		schemas := s.Tags
+		if stmt.Kind == StatementCreateEdge {
+			schemas = s.Edges
+		}
+		if _, ok := schemas[stmt.Name]; ok {
+			return false
+		}
+		props := []*Prop{}
+		for i, name := range stmt.Props[stmt.Name] {
+			prop := &Prop{Name: name}
+			if i < len(stmt.Types) {
+				prop.Type = NormalizeType(stmt.Types[i])
+			}
+			props = append(props, prop)
+		}
+		schemas[stmt.Name] = props
+		return true
+	case StatementCreateTagIndex, StatementCreateEdgeIndex:
+		if _, ok := s.Indexes[stmt.Index]; ok {
+			return false
+		}
+		schema := SchemaTag
+		if stmt.Kind == StatementCreateEdgeIndex {
+			schema = SchemaEdge
+		}
+		s.Indexes[stmt.Index] = &Index{Schema: schema, Name: stmt.Name, Props: stmt.Props[stmt.Name]}
+		return true
+	}
+	return false
+}
+
+func diffProps(schema string, name string, registered []*Prop, live []*Prop) []*SchemaDrift {
+	drifts := []*SchemaDrift{}
+	types := map[string]string{}
+	for _, prop := range live {
+		types[prop.Name] = prop.Type
+	}
+	for _, prop := range registered {
+		typ, ok := types[prop.Name]
+		delete(types, prop.Name)
+		switch {
+		case !ok:
+			drifts = append(drifts, &SchemaDrift{Schema: schema, Name: name, Prop: prop.Name, Drift: DriftMissing, Registered: prop.Type})
+		case prop.Type != "" && NormalizeType(typ) != prop.Type:
+			drifts = append(drifts, &SchemaDrift{Schema: schema, Name: name, Prop: prop.Name, Drift: DriftType, Registered: prop.Type, Live: typ})
+		}
+	}
+	for _, prop := range live {
+		if typ, ok := types[prop.Name]; ok {
+			drifts = append(drifts, &SchemaDrift{Schema: schema, Name: name, Prop: prop.Name, Drift: DriftUnregistered, Live: typ})
+		}
+	}
+	return drifts
+}
+
+func diffSchemas(schema string, registered map[string][]*Prop, live map[string][]*Prop) []*SchemaDrift {
+	drifts := []*SchemaDrift{}
+	for name, props := range registered {
+		liveProps, ok := live[name]
+		if !ok {
+			drifts = append(drifts, &SchemaDrift{Schema: schema, Name: name, Drift: DriftMissing})
+			continue
+		}
+		drifts = append(drifts, diffProps(schema, name, props, liveProps)...)
+	}
+	for name := range live {
+		if _, ok := registered[name]; !ok {
+			drifts = append(drifts, &SchemaDrift{Schema: schema, Name: name, Drift: DriftUnregistered})
+		}
+	}
+	return drifts
+}
+
+// DiffSchema returns the drifts of the live schema from the registered one
+// by schema and name.
+func DiffSchema(registered *Schema, live *Schema) []*SchemaDrift {
+	drifts := diffSchemas(SchemaTag, registered.Tags, live.Tags)
+	drifts = append(drifts, diffSchemas(SchemaEdge, registered.Edges, live.Edges)...)
+	for name, index := range registered.Indexes {
+		if _, ok := live.Indexes[name]; !ok {
+			drifts = append(drifts, &SchemaDrift{Schema: SchemaIndex, Name: name, Drift: DriftMissing, Registered: index.Name})
+		}
+	}
+	for name, index := range live.Indexes {
+		if _, ok := registered.Indexes[name]; !ok {
+			drifts = append(drifts, &SchemaDrift{Schema: SchemaIndex, Name: name, Drift: DriftUnregistered, Live: index.Name})
+		}
+	}
+	sort.SliceStable(drifts, func(i, j int) bool {
+		if drifts[i].Schema != drifts[j].Schema {
+			return drifts[i].Schema < drifts[j].Schema
+		}
+		if drifts[i].Name != drifts[j].Name {
+			return drifts[i].Name < drifts[j].Name
+		}
+		return drifts[i].Prop < drifts[j].Prop
+	})
+	return drifts
+}
@@ -0,0 +1,155 @@
+package graph
+
+import (
+	"github.com/EpiK-Protocol/go-epik-gateway/app/config"
+	"golang.org/x/xerrors"
+)
+
+// ErrUnavailable is returned when the store can't be reached, eg: no graphd
+// host is up or the connection broke.
+var ErrUnavailable = xerrors.New("graph store unavailable")
+
+// ErrNotSent is an unavailable store which a request never reached.
+var ErrNotSent = xerrors.Errorf("request not sent: %w", ErrUnavailable)
+
+// IsUnavailable reports whether err is about reaching the store.
+func IsUnavailable(err error) bool {
+	return xerrors.Is(err, ErrUnavailable)
+}
+
+// NotApplied reports whether nothing of the failed request was applied: it
+// was never sent, or the store refused it as a whole.
+func NotApplied(err error) bool {
+	return xerrors.Is(err, ErrNotSent) || isRefused(err)
+}
+
+// GraphStore is a graph database the expert files are replayed into and the
+// api queries. Spaces passed to it are the database spaces, versions are
+// resolved by the caller.
+type GraphStore interface {
+	// CreateSchema creates the space, tags, edges and indexes of stmts in
+	// space and waits until they are visible, on redo existing schemas are
+	// tolerated.
+	CreateSchema(space string, stmts []*Statement, redo bool) error
+	// Upsert writes the vertices and edges of the insert and upsert stmts
+	// into space.
+	Upsert(space string, stmts []*Statement) error
+	// RebuildIndex submits a rebuild of the TAG, EDGE or FULLTEXT indexes of
+	// space, it returns the job id or -1 when none is created.
+	RebuildIndex(space string, kind string) (int64, error)
+	// JobStatus returns the status of a rebuild job, eg: FINISHED.
+	JobStatus(space string, job int64) (string, error)
+	DropSpace(space string) error
+	// SubmitStats submits a job counting the vertices and edges of space, it
+	// returns the job id or -1 when the counts are always current.
+	SubmitStats(space string) (int64, error)
+	// Stats returns the counts of the last stats job of space.
+	Stats(space string) (*Stats, error)
+
+	// Schema returns the live tags, edges and indexes of space.
+	Schema(space string) (*Schema, error)
+
+	// Query runs sql in the query language of the store.
+	Query(sql string) ([]Result, error)
+	// Export walks the vertices and edges of space.
+	Export(space string, vertex func(*Vertex) error, edge func(*Edge) error) error
+
+	// Health checks the hosts of the store.
+	Health() []*HostHealth
+	Start()
+	Close()
+}
+
+// NewStore returns the graph store of the configured backend.
+func NewStore(conf config.Config) (GraphStore, error) {
+	switch conf.Graph.Backend {
+	case config.GraphNebula, "":
+		pool, err := NewPool(conf.Nebula)
+		if err != nil {
+			return nil, err
+		}
+		return NewNebulaStore(pool, conf.Replay.SchemaTimeout), nil
+	case config.GraphMemory:
+		return NewMemoryStore(), nil
+	}
+	return nil, xerrors.Errorf("unknown graph backend %s", conf.Graph.Backend)
+}
+
+// Vertex is an exported vertex with properties keyed by "tag.prop".
+type Vertex struct {
+	ID    string
+	Props map[string]interface{}
+}
+
+// Edge is an exported edge.
+type Edge struct {
+	Type  int64
+	Src   string
+	Dst   string
+	Rank  int64
+	Name  string
+	Props map[string]interface{}
+}
+
+// Stats is the count of vertices by tag and edges by edge type of a space.
+type Stats struct {
+	Tags     map[string]int64 `json:"tags"`
+	Edges    map[string]int64 `json:"edges"`
+	Vertices int64            `json:"vertices"`
+	// edges of all types.
+	Relations int64 `json:"relations"`
+}
+
+func NewStats() *Stats {
+	return &Stats{Tags: map[string]int64{}, Edges: map[string]int64{}}
+}
+
+type ResultData struct {
+	Row  []interface{} `json:"row"`
+	Meta []interface{} `json:"meta"`
+}
+
+type Result struct {
+	Columns     []string     `json:"columns"`
+	Data        []ResultData `json:"data"`
+	LatencyInUs int          `json:"latencyInUs"`
+	SpaceName   string       `json:"spaceName"`
+	PlanDesc    struct {
+		PlanNodeDescs []struct {
+			Name        string `json:"name"`
+			ID          int    `json:"id"`
+			OutputVar   string `json:"outputVar"`
+			Description struct {
+				Key string `json:"key"`
+			} `json:"description"`
+			Profiles []struct {
+				Rows              int `json:"rows"`
+				ExecDurationInUs  int `json:"execDurationInUs"`
+				TotalDurationInUs int `json:"totalDurationInUs"`
+				OtherStats        struct {
+				} `json:"otherStats"`
+			} `json:"profiles"`
+			BranchInfo struct {
+				IsDoBranch      bool `json:"isDoBranch"`
+				ConditionNodeID int  `json:"conditionNodeId"`
+			} `json:"branchInfo"`
+			Dependencies []interface{} `json:"dependencies"`
+		} `json:"planNodeDescs"`
+		NodeIndexMap struct {
+		} `json:"nodeIndexMap"`
+		Format           string `json:"format"`
+		OptimizeTimeInUs int    `json:"optimize_time_in_us"`
+	} `json:"planDesc "`
+	Comment string `json:"comment "`
+}
+
+type ResultError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Struct used for storing the parsed object
+type ResultSet struct {
+	Results []Result      `json:"results"`
+	Errors  []ResultError `json:"errors"`
+}
@@ -0,0 +1,33 @@
+package service
+
+import (
+	"github.com/EpiK-Protocol/go-epik-gateway/app/config"
+	"github.com/EpiK-Protocol/go-epik-gateway/graph"
+)
+
+type GraphService struct {
+	conf config.Config
+
+	store graph.GraphStore
+}
+
+func NewGraph(app App) (*GraphService, error) {
+	return &GraphService{
+		conf:  app.Config(),
+		store: app.Graph(),
+	}, nil
+}
+
+func (s *GraphService) Query(sql string) ([]graph.Result, error) {
+	return s.store.Query(sql)
+}
+
+// Export walks the vertices and edges of space.
+func (s *GraphService) Export(space string, vertex func(*graph.Vertex) error, edge func(*graph.Edge) error) error {
+	return s.store.Export(space, vertex, edge)
+}
+
+// Health checks the hosts of the graph store.
+func (s *GraphService) Health() []*graph.HostHealth {
+	return s.store.Health()
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"github.com/EpiK-Protocol/go-epik-gateway/app/config"
+	"github.com/EpiK-Protocol/go-epik-gateway/graph"
 	"github.com/EpiK-Protocol/go-epik-gateway/storage"
 	"github.com/sirupsen/logrus"
 )
@@ -12,27 +13,28 @@ type App interface {
 	Config() config.Config
 	Storage() storage.Storage
 	Log() *logrus.Logger
+	Graph() graph.GraphStore
 }
 
 type IService interface {
-	Nebula() *NebulasService
+	Graph() *GraphService
 }
 
 type Servive struct {
-	nebula *NebulasService
+	graph *GraphService
 }
 
 func NewService(app App) (IService, error) {
 	log = app.Log()
-	nebula, err := NewNebula(app)
+	graph, err := NewGraph(app)
 	if err != nil {
 		return nil, err
 	}
 	return &Servive{
-		nebula: nebula,
+		graph: graph,
 	}, nil
 }
 
-func (s *Servive) Nebula() *NebulasService {
-	return s.nebula
+func (s *Servive) Graph() *GraphService {
+	return s.graph
 }
@@ -119,6 +119,43 @@ func (storage *BadgerStorage) Del(key []byte) error {
 	})
 }
 
+// Write put or delete all entries atomically.
+func (storage *BadgerStorage) Write(entries ...Entry) error {
+	return storage.db.Update(func(txn *badger.Txn) error {
+		for _, entry := range entries {
+			if entry.Value == nil {
+				if err := txn.Delete(entry.Key); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := txn.Set(entry.Key, entry.Value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Iterate call fn for every key-value entry which key has the prefix.
+func (storage *BadgerStorage) Iterate(prefix []byte, fn func(key []byte, value []byte) error) error {
+	return storage.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			item := it.Item()
+			value, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			if err := fn(item.KeyCopy(nil), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 // Close levelDB
 func (storage *BadgerStorage) Close() error {
 	return storage.db.Close()
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"bytes"
 	"sync"
 
 	byteutils "github.com/EpiK-Protocol/go-epik-gateway/utils/bytesutils"
@@ -47,6 +48,39 @@ func (db *MemoryStorage) Del(key []byte) error {
 	return nil
 }
 
+// Write put or delete all entries.
+func (db *MemoryStorage) Write(entries ...Entry) error {
+	for _, entry := range entries {
+		if entry.Value == nil {
+			db.data.Delete(byteutils.Hex(entry.Key))
+			continue
+		}
+		db.data.Store(byteutils.Hex(entry.Key), entry.Value)
+	}
+	return nil
+}
+
+// Iterate call fn for every key-value entry which key has the prefix.
+func (db *MemoryStorage) Iterate(prefix []byte, fn func(key []byte, value []byte) error) error {
+	var err error
+	db.data.Range(func(k, v interface{}) bool {
+		key, e := byteutils.FromHex(k.(string))
+		if e != nil {
+			err = e
+			return false
+		}
+		if !bytes.HasPrefix(key, prefix) {
+			return true
+		}
+		if e := fn(key, v.([]byte)); e != nil {
+			err = e
+			return false
+		}
+		return true
+	})
+	return err
+}
+
 // EnableBatch enable batch write.
 func (db *MemoryStorage) EnableBatch() {
 }
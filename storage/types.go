@@ -7,6 +7,12 @@ var (
 	ErrKeyNotFound = errors.New("Key not found")
 )
 
+// Entry is a key-value entry of an atomic write, nil value deletes the key.
+type Entry struct {
+	Key   []byte
+	Value []byte
+}
+
 // Storage interface of Storage.
 type Storage interface {
 	// Get return the value to the key in Storage.
@@ -18,6 +24,12 @@ type Storage interface {
 	// Del delete the key entry in Storage.
 	Del(key []byte) error
 
+	// Write put or delete all entries atomically.
+	Write(entries ...Entry) error
+
+	// Iterate call fn for every key-value entry which key has the prefix.
+	Iterate(prefix []byte, fn func(key []byte, value []byte) error) error
+
 	// EnableBatch enable batch write.
 	EnableBatch()
 
@@ -0,0 +1,220 @@
+package task
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/EpiK-Protocol/go-epik-gateway/app/config"
+	"github.com/EpiK-Protocol/go-epik-gateway/graph"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// delay before each write of a slowed down space.
+	slowdownMin = 100 * time.Millisecond
+	slowdownMax = 10 * time.Second
+
+	breakerPauseMax = 10 * time.Minute
+)
+
+// spaceThrottle limits the writes into a nebula space, the delay grows on
+// backpressure and shrinks again on fast writes.
+type spaceThrottle struct {
+	limiter *rate.Limiter
+
+	lk    sync.Mutex
+	delay time.Duration
+}
+
+func (t *spaceThrottle) wait(n int) error {
+	if t.limiter != nil {
+		if n > t.limiter.Burst() {
+			n = t.limiter.Burst()
+		}
+		if err := t.limiter.WaitN(context.Background(), n); err != nil {
+			return err
+		}
+	}
+	t.lk.Lock()
+	delay := t.delay
+	t.lk.Unlock()
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+	return nil
+}
+
+func (t *spaceThrottle) slowDown() time.Duration {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	t.delay *= 2
+	if t.delay < slowdownMin {
+		t.delay = slowdownMin
+	}
+	if t.delay > slowdownMax {
+		t.delay = slowdownMax
+	}
+	return t.delay
+}
+
+func (t *spaceThrottle) speedUp() {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	t.delay = t.delay * 3 / 4
+	if t.delay < slowdownMin {
+		t.delay = 0
+	}
+}
+
+// graphBreaker pauses the replay while graphd is unreachable, writes are
+// tried again once the pause passed and close it on success.
+type graphBreaker struct {
+	base time.Duration
+
+	lk    sync.Mutex
+	until time.Time
+	pause time.Duration
+}
+
+func newGraphBreaker(pause time.Duration) *graphBreaker {
+	if pause <= 0 {
+		pause = config.DefaultBreakerPause
+	}
+	return &graphBreaker{base: pause, pause: pause}
+}
+
+// paused returns the rest of the pause, zero when writes are allowed.
+func (b *graphBreaker) paused() time.Duration {
+	b.lk.Lock()
+	defer b.lk.Unlock()
+	if wait := time.Until(b.until); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+func (b *graphBreaker) open(err error) {
+	b.lk.Lock()
+	defer b.lk.Unlock()
+	if time.Now().Before(b.until) {
+		return
+	}
+	b.until = time.Now().Add(b.pause)
+	log.WithFields(logrus.Fields{
+		"pause": b.pause,
+		"error": err,
+	}).Warn("nebula unreachable, pause replay.")
+	b.pause *= 2
+	if b.pause > breakerPauseMax {
+		b.pause = breakerPauseMax
+	}
+}
+
+func (b *graphBreaker) close() {
+	b.lk.Lock()
+	defer b.lk.Unlock()
+	if b.until.IsZero() {
+		return
+	}
+	b.until = time.Time{}
+	b.pause = b.base
+	log.Info("nebula reachable, resume replay.")
+}
+
+// throttledStore is the graph store of the replay. Writes are rate limited by
+// space, idempotent ones retried on overload and leader changes, and all are
+// refused while graphd is unreachable.
+type throttledStore struct {
+	graph.GraphStore
+	conf    config.Replay
+	breaker *graphBreaker
+
+	lk     sync.Mutex
+	spaces map[string]*spaceThrottle
+}
+
+func newThrottledStore(conf config.Replay, store graph.GraphStore) *throttledStore {
+	return &throttledStore{
+		GraphStore: store,
+		conf:       conf,
+		breaker:    newGraphBreaker(conf.BreakerPause),
+		spaces:     map[string]*spaceThrottle{},
+	}
+}
+
+func (s *throttledStore) throttle(space string) *spaceThrottle {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	throttle, ok := s.spaces[space]
+	if !ok {
+		throttle = &spaceThrottle{}
+		if s.conf.RateLimit > 0 {
+			burst := s.conf.RateLimit
+			if burst < s.conf.BatchSize {
+				burst = s.conf.BatchSize
+			}
+			throttle.limiter = rate.NewLimiter(rate.Limit(s.conf.RateLimit), burst)
+		}
+		s.spaces[space] = throttle
+	}
+	return throttle
+}
+
+func (s *throttledStore) CreateSchema(space string, stmts []*graph.Statement, redo bool) error {
+	return s.write(space, len(stmts), true, func(attempt int) error {
+		// a failed attempt may have created part of the schema.
+		return s.GraphStore.CreateSchema(space, stmts, redo || attempt > 0)
+	})
+}
+
+func (s *throttledStore) Upsert(space string, stmts []*graph.Statement) error {
+	return s.write(space, len(stmts), graph.Idempotent(stmts), func(attempt int) error {
+		return s.GraphStore.Upsert(space, stmts)
+	})
+}
+
+// write runs fn after the throttle of space. Overloads and leader changes
+// are retried only when fn can be executed twice, a batch may have been
+// applied up to the failing statement.
+func (s *throttledStore) write(space string, n int, idem bool, fn func(attempt int) error) error {
+	if pause := s.breaker.paused(); pause > 0 {
+		return xerrors.Errorf("replay paused for %s: %w", pause.Round(time.Millisecond), graph.ErrNotSent)
+	}
+	throttle := s.throttle(space)
+	for attempt := 0; ; attempt++ {
+		if err := throttle.wait(n); err != nil {
+			return err
+		}
+		start := time.Now()
+		err := fn(attempt)
+		if err == nil {
+			s.breaker.close()
+			if s.conf.SlowWrite > 0 && time.Since(start) > s.conf.SlowWrite {
+				throttle.slowDown()
+			} else {
+				throttle.speedUp()
+			}
+			return nil
+		}
+		if graph.IsUnavailable(err) {
+			s.breaker.open(err)
+			return err
+		}
+		if !graph.IsLeaderChanged(err) && !graph.IsOverloaded(err) {
+			return err
+		}
+		delay := throttle.slowDown()
+		if attempt >= s.conf.WriteRetries || !idem {
+			return err
+		}
+		log.WithFields(logrus.Fields{
+			"space":   space,
+			"attempt": attempt + 1,
+			"delay":   delay,
+			"error":   err,
+		}).Warn("nebula backpressure, retry write.")
+	}
+}
@@ -0,0 +1,69 @@
+package task
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/EpiK-Protocol/go-epik-gateway/app/config"
+	"github.com/EpiK-Protocol/go-epik-gateway/utils"
+)
+
+// httpClient sends outbound requests through the configured proxy and tls.
+type httpClient struct {
+	*http.Client
+
+	conf config.HTTPClient
+}
+
+func newHTTPClient(conf config.HTTPClient) (*httpClient, error) {
+	tlsConf, err := utils.TLSConfig(conf.CAFile, conf.CertFile, conf.KeyFile, conf.InsecureSkipVerify)
+	if err != nil {
+		return nil, err
+	}
+
+	proxy := http.ProxyFromEnvironment
+	if len(conf.Proxy) > 0 {
+		proxyUrl, err := url.Parse(conf.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		proxy = http.ProxyURL(proxyUrl)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxy
+	transport.TLSClientConfig = tlsConf
+	transport.DialContext = (&net.Dialer{
+		Timeout:   conf.DialTimeout,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	transport.ResponseHeaderTimeout = conf.ResponseHeaderTimeout
+
+	return &httpClient{
+		Client: &http.Client{Transport: transport},
+		conf:   conf,
+	}, nil
+}
+
+// apiRequest builds a request with the configured auth headers and timeout.
+func (c *httpClient) apiRequest(ctx context.Context, method, url string) (*http.Request, context.CancelFunc, error) {
+	cancel := func() {}
+	if c.conf.RequestTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, c.conf.RequestTimeout)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	for key, value := range c.conf.Headers {
+		req.Header.Set(key, value)
+	}
+	if len(c.conf.BearerToken) > 0 {
+		req.Header.Set("Authorization", "Bearer "+c.conf.BearerToken)
+	}
+	return req, cancel, nil
+}
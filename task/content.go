@@ -0,0 +1,141 @@
+package task
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/EpiK-Protocol/go-epik-gateway/app/config"
+	"github.com/EpiK-Protocol/go-epik-gateway/storage"
+	"github.com/EpiK-Protocol/go-epik-gateway/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// contentLk guards read-modify-write of content index entries.
+var contentLk sync.Mutex
+
+// ContentKey returns the key of file ids sharing the same content.
+func ContentKey(content string) []byte {
+	return []byte("task:content:" + content)
+}
+
+// contentID identifies file bytes by root cid, or by checksum when the
+// file comes from the download url.
+func contentID(file *FileRef) string {
+	if file.RootCID.Defined() {
+		return "cid:" + file.RootCID.String()
+	}
+	if len(file.CheckSum) > 0 {
+		return "md5:" + strings.ToLower(file.CheckSum)
+	}
+	return ""
+}
+
+// addContent indexes a downloaded file by its content.
+func addContent(st storage.Storage, file *FileRef) error {
+	content := contentID(file)
+	if content == "" {
+		return nil
+	}
+
+	contentLk.Lock()
+	defer contentLk.Unlock()
+	ids, err := loadFileList(st, ContentKey(content))
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if id == file.ID {
+			return nil
+		}
+	}
+	return saveFileList(st, ContentKey(content), append(ids, file.ID))
+}
+
+// linkContent links the local path of file to an already stored file with
+// the same content, reports whether file was linked. The content is copied
+// when it can't be linked, outside of the content lock.
+func linkContent(conf config.Config, st storage.Storage, file *FileRef) (bool, error) {
+	content := contentID(file)
+	if content == "" {
+		return false, nil
+	}
+	src, err := contentSource(st, file, content)
+	if err != nil || src == nil {
+		return false, err
+	}
+
+	path := file.LocalPath
+	if isCompressedPath(path) {
+		path = strings.TrimSuffix(path, filepath.Ext(path))
+	}
+	if isCompressedPath(src.LocalPath) {
+		path += filepath.Ext(src.LocalPath)
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	linked := true
+	if err := os.Link(src.LocalPath, path); err != nil {
+		info, err := os.Stat(src.LocalPath)
+		if os.IsNotExist(err) {
+			// the source was evicted meanwhile.
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if err := ensureFreeSpace(conf, info.Size()); err != nil {
+			return false, err
+		}
+		if err := utils.CopyFile(src.LocalPath, path); err != nil {
+			return false, err
+		}
+		linked = false
+	}
+	file.LocalPath = path
+
+	log.WithFields(logrus.Fields{
+		"id":      file.ID,
+		"source":  src.ID,
+		"content": content,
+		"path":    path,
+		"linked":  linked,
+	}).Info("link file to stored content.")
+	return true, nil
+}
+
+// contentSource returns a downloaded file other than file with content, nil
+// without any.
+func contentSource(st storage.Storage, file *FileRef, content string) (*FileRef, error) {
+	contentLk.Lock()
+	defer contentLk.Unlock()
+	ids, err := loadFileList(st, ContentKey(content))
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		if id == file.ID {
+			continue
+		}
+		src, err := loadFile(st, id)
+		if err == storage.ErrKeyNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if src.Status < FileStatusDownloaded {
+			continue
+		}
+		exist, err := utils.Exists(src.LocalPath)
+		if err != nil {
+			return nil, err
+		}
+		if exist {
+			return src, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,52 @@
+package task
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/EpiK-Protocol/go-epik-gateway/app/config"
+	"github.com/EpiK-Protocol/go-epik-gateway/storage"
+)
+
+func TestLinkContent(t *testing.T) {
+	st, err := storage.NewMemoryStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	src := &FileRef{ID: "a", CheckSum: "AB", LocalPath: filepath.Join(dir, "a"), Status: FileStatusDownloaded}
+	writeTestFile(t, src.LocalPath, 10)
+	if err := saveFile(st, src); err != nil {
+		t.Fatal(err)
+	}
+	if err := addContent(st, src); err != nil {
+		t.Fatal(err)
+	}
+
+	file := &FileRef{ID: "b", CheckSum: "ab", LocalPath: filepath.Join(dir, "b")}
+	linked, err := linkContent(config.Config{}, st, file)
+	if err != nil || !linked {
+		t.Fatalf("not linked: %v", err)
+	}
+	a, err := os.Stat(src.LocalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.Stat(file.LocalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(a, b) {
+		t.Error("content copied on the same device")
+	}
+
+	// an evicted source is downloaded again.
+	if err := os.Remove(src.LocalPath); err != nil {
+		t.Fatal(err)
+	}
+	other := &FileRef{ID: "c", CheckSum: "ab", LocalPath: filepath.Join(dir, "c")}
+	if linked, err := linkContent(config.Config{}, st, other); err != nil || linked {
+		t.Errorf("linked to an evicted source: %v", err)
+	}
+}
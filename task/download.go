@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/EpiK-Protocol/go-epik-gateway/app/config"
 	"github.com/EpiK-Protocol/go-epik-gateway/storage"
@@ -27,6 +28,8 @@ type downloadTask struct {
 
 	storage storage.Storage
 	bus     EventBus.Bus
+	client  *httpClient
+	limiter *transferLimiter
 
 	lk    sync.Mutex
 	files map[string]*FileRef
@@ -37,11 +40,13 @@ type downloadTask struct {
 	page uint64
 }
 
-func newDownloadTask(conf config.Config, st storage.Storage, bus EventBus.Bus) (*downloadTask, error) {
+func newDownloadTask(conf config.Config, st storage.Storage, bus EventBus.Bus, client *httpClient, limiter *transferLimiter) (*downloadTask, error) {
 	task := &downloadTask{
 		conf:        conf,
 		bus:         bus,
 		storage:     st,
+		client:      client,
+		limiter:     limiter,
 		files:       nil,
 		quitChs:     map[string]chan bool{},
 		needRefresh: false,
@@ -80,11 +85,15 @@ func (t *downloadTask) process(ctx context.Context) error {
 		}).Info("load download files.")
 	}
 
-	if err := t.fetchDatas(t.needRefresh); err != nil {
+	if err := t.fetchDatas(ctx, t.needRefresh); err != nil {
 		return err
 	}
 
-	t.downloadDatas()
+	if !t.limiter.inWindow(time.Now()) {
+		log.Debug("outside transfer window, skip download.")
+		return nil
+	}
+	t.downloadDatas(ctx)
 
 	return nil
 }
@@ -95,14 +104,22 @@ func (t *downloadTask) stop() {
 	}
 }
 
-func (t *downloadTask) fetchDatas(reflesh bool) error {
+func (t *downloadTask) fetchDatas(ctx context.Context, reflesh bool) error {
 	url := fmt.Sprintf("%s/sequence/allFileList?status=send&page=%d", t.conf.Server.DownloadUrl, t.page)
-	resp, err := http.Get(url)
+	req, cancel, err := t.client.apiRequest(ctx, http.MethodGet, url)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	resp, err := t.client.Do(req)
 	if err != nil {
 		return err
 	}
 
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return xerrors.Errorf("failed to fetch file list, url:%s, status:%s", url, resp.Status)
+	}
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return err
@@ -154,7 +171,10 @@ func (t *downloadTask) fetchDatas(reflesh bool) error {
 		dir := t.conf.Storage.DataDir
 		path := fmt.Sprintf("%s/%s", dir, file.ID)
 		file.Path = path
-		file.LocalPath = path
+		// a downloaded file may be kept compressed, its raw path removed.
+		if exist, _ := utils.Exists(file.LocalPath); !exist {
+			file.LocalPath = path
+		}
 
 		if file.Status < FileStatusDownloaded {
 			listChanged = true
@@ -177,17 +197,17 @@ func (t *downloadTask) fetchDatas(reflesh bool) error {
 	return nil
 }
 
-func (t *downloadTask) downloadDatas() {
+func (t *downloadTask) downloadDatas(ctx context.Context) {
 	for _, file := range t.files {
 		if file.Status > FileStatusDownloading {
 			continue
 		}
-		go t.asyncDownload(file)
+		go t.asyncDownload(ctx, file)
 	}
 }
 
-func (t *downloadTask) asyncDownload(file *FileRef) {
-	err := t.download(file)
+func (t *downloadTask) asyncDownload(ctx context.Context, file *FileRef) {
+	err := t.download(ctx, file)
 	if err != nil {
 		log.WithFields(logrus.Fields{
 			"fileRef": file,
@@ -196,7 +216,74 @@ func (t *downloadTask) asyncDownload(file *FileRef) {
 	}
 }
 
-func (t *downloadTask) download(file *FileRef) error {
+func (t *downloadTask) download(ctx context.Context, file *FileRef) error {
+	linked, err := linkContent(t.conf, t.storage, file)
+	if err != nil {
+		return err
+	}
+	if !linked {
+		if err := t.fetchFile(ctx, file); err != nil {
+			return err
+		}
+	}
+
+	if file.Status < FileStatusDownloading {
+		if _, err := validateFile(file); err != nil {
+			return err
+		}
+		if codec := t.conf.Storage.Compression; codec != utils.CodecNone {
+			if err := compressLocalFile(t.storage, file, codec); err != nil {
+				return err
+			}
+		}
+		file.Status = FileStatusDownloaded
+		if err := saveFile(t.storage, file); err != nil {
+			log.Errorf("failed to save file:%v", err)
+			return err
+		}
+		log.Info("file downloaded:", file.ID)
+
+		if err := addContent(t.storage, file); err != nil {
+			log.Errorf("failed to index file content:%v", err)
+		}
+
+		t.bus.Publish(FileEventDownloaded, file.ID)
+
+		t.lk.Lock()
+		defer t.lk.Unlock()
+		delete(t.files, file.ID)
+
+		delete(t.quitChs, file.ID)
+
+		if err := saveDatas(t.storage, DownloadFilesKey, t.files, false); err != nil {
+			log.Errorf("failed to save file:%v", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fetchFile downloads file unless a local copy matches its checksum.
+func (t *downloadTask) fetchFile(ctx context.Context, file *FileRef) error {
+	if isCompressedPath(file.LocalPath) {
+		exist, err := utils.Exists(file.LocalPath)
+		if err != nil {
+			return err
+		}
+		if exist {
+			checkSum, err := getDecompressedMd5(file.LocalPath)
+			if err != nil {
+				return err
+			}
+			if len(file.CheckSum) == 0 || checkSum == file.CheckSum {
+				return nil
+			}
+		}
+		// the raw file is downloaded and compressed again.
+		file.LocalPath = file.Path
+	}
+
 	exist, err := utils.Exists(file.Path)
 	if err != nil {
 		return err
@@ -215,10 +302,14 @@ func (t *downloadTask) download(file *FileRef) error {
 	}
 
 	if needDownload {
-		err = t.fileDownload(file.Url, file.Path)
+		if err := ensureFreeSpace(t.conf, file.FileSize); err != nil {
+			return err
+		}
+		err = t.fileDownload(ctx, file.Url, file.Path)
 		if err != nil {
 			return err
 		}
+		file.LocalPath = file.Path
 	}
 
 	checkSum, err := getFileMd5(file.Path)
@@ -234,38 +325,23 @@ func (t *downloadTask) download(file *FileRef) error {
 		}).Error("failed to check checksum.")
 		return xerrors.Errorf("failed to check file checksum.")
 	}
-	if file.Status < FileStatusDownloading {
-		file.Status = FileStatusDownloaded
-		if err := saveFile(t.storage, file); err != nil {
-			log.Errorf("failed to save file:%v", err)
-			return err
-		}
-		log.Info("file downloaded:", file.ID)
-
-		t.bus.Publish(FileEventDownloaded, file.ID)
-
-		t.lk.Lock()
-		defer t.lk.Unlock()
-		delete(t.files, file.ID)
-
-		delete(t.quitChs, file.ID)
-
-		if err := saveDatas(t.storage, DownloadFilesKey, t.files, false); err != nil {
-			log.Errorf("failed to save file:%v", err)
-			return err
-		}
-	}
-
 	return nil
 }
 
-func (t *downloadTask) fileDownload(url, path string) error {
+func (t *downloadTask) fileDownload(ctx context.Context, url, path string) error {
 	// Get the data
-	resp, err := http.Get(url)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := t.client.Do(req)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return xerrors.Errorf("failed to download file, url:%s, status:%s", url, resp.Status)
+	}
 
 	out, err := os.Create(path)
 	if err != nil {
@@ -273,7 +349,7 @@ func (t *downloadTask) fileDownload(url, path string) error {
 	}
 	defer out.Close()
 
-	_, err = io.Copy(out, resp.Body)
+	_, err = io.Copy(out, t.limiter.Reader(ctx, req.URL.Hostname(), resp.Body, true))
 	if err != nil {
 		return err
 	}
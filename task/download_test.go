@@ -0,0 +1,72 @@
+package task
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/EpiK-Protocol/go-epik-gateway/app/config"
+	"github.com/EpiK-Protocol/go-epik-gateway/storage"
+	"github.com/EpiK-Protocol/go-epik-gateway/utils"
+	"github.com/asaskevich/EventBus"
+)
+
+func TestDownloadCompressedFile(t *testing.T) {
+	content := "domain:sp,index:1\nUSE sp\n"
+	sum := md5.Sum([]byte(content))
+	var downloads int32
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	mux.HandleFunc("/sequence/allFileList", func(w http.ResponseWriter, r *http.Request) {
+		list := ListResponse{List: []ListData{{Id: "f1", Expert: "e", Index: 1, FileUrl: srv.URL + "/f1", CheckSum: hex.EncodeToString(sum[:])}}}
+		json.NewEncoder(w).Encode(list)
+	})
+	mux.HandleFunc("/f1", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&downloads, 1)
+		w.Write([]byte(content))
+	})
+
+	conf := config.Config{}
+	conf.Storage.DataDir = t.TempDir()
+	conf.Storage.Compression = utils.CodecGzip
+	conf.Server.DownloadUrl = srv.URL
+	st, _ := storage.NewMemoryStorage()
+	client, err := newHTTPClient(conf.Server.HTTPClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	limiter, _ := newTransferLimiter(conf.Transfer)
+	task, _ := newDownloadTask(conf, st, EventBus.New(), client, limiter)
+	task.files = map[string]*FileRef{}
+	ctx := context.Background()
+
+	for i, refresh := range []bool{false, true} {
+		task.page = 0
+		if err := task.fetchDatas(ctx, refresh); err != nil {
+			t.Fatal(err)
+		}
+		file := task.files["f1"]
+		if file == nil {
+			t.Fatalf("%d: file not listed", i)
+		}
+		if err := task.download(ctx, file); err != nil {
+			t.Fatal(err)
+		}
+		if want := filepath.Join(conf.Storage.DataDir, "f1.gz"); file.LocalPath != want {
+			t.Errorf("%d: local path %s", i, file.LocalPath)
+		}
+		if exist, _ := utils.Exists(file.Path); exist {
+			t.Errorf("%d: raw file kept", i)
+		}
+	}
+	if downloads != 1 {
+		t.Errorf("downloaded %d times", downloads)
+	}
+}
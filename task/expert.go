@@ -0,0 +1,172 @@
+package task
+
+import (
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/EpiK-Protocol/go-epik-gateway/graph"
+	"github.com/EpiK-Protocol/go-epik-gateway/storage"
+	"golang.org/x/xerrors"
+)
+
+// Replayer inspects and controls the replay of experts.
+type Replayer interface {
+	// Experts returns the replay status of all experts.
+	Experts() ([]*ExpertStatus, error)
+
+	// Expert returns the replay status of expert with its audit entries.
+	Expert(expert string) (*ExpertStatus, error)
+
+	// Advance force the replay of expert to the start of file index, zero
+	// for the next index.
+	Advance(expert string, index int64, reason string) (*ExpertStatus, error)
+
+	// Rebuild re-imports all files of expert, a dry run returns the plan with
+	// the token confirming it.
+	Rebuild(expert string, mode string, dryRun bool, token string) (*RebuildPlan, error)
+
+	// Spaces returns the versions of spaces rebuilt in shadow.
+	Spaces() ([]*SpaceVersions, error)
+
+	// Rollback switches space back to a kept version, the newest one when to
+	// is empty.
+	Rollback(space string, to string) (*SpaceVersions, error)
+
+	// ResolveSpace returns the nebula space serving space.
+	ResolveSpace(space string) string
+
+	// Schema returns the registered schema of space with its changes from
+	// the oldest.
+	Schema(space string) (*SpaceSchema, []*SchemaChange, error)
+
+	// Reconciliation returns the reconcile reports of the imported files of
+	// expert.
+	Reconciliation(expert string) (*ExpertReconcile, error)
+
+	// Validate checks a file of expert without writing anything, name
+	// identifies the file in the report.
+	Validate(expert string, name string, data io.Reader, ngql bool) (*ValidateReport, error)
+
+	// SchemaDrift diffs the registered schema of space against the live one.
+	SchemaDrift(space string) ([]*graph.SchemaDrift, error)
+}
+
+// ExpertStatus is the replay progress of an expert.
+type ExpertStatus struct {
+	Expert   string  `json:"expert"`
+	Space    string  `json:"space,omitempty"`
+	Domain   string  `json:"domain,omitempty"`
+	Index    int64   `json:"index"`
+	Line     int64   `json:"line"`
+	Files    int     `json:"files"`
+	Missing  []int64 `json:"missing"`
+	GapSince int64   `json:"gap_since,omitempty"`
+	Failed   string  `json:"failed,omitempty"`
+	Rejected int64   `json:"rejected,omitempty"`
+	Shadow   string  `json:"shadow,omitempty"`
+
+	Audits []*AuditEntry `json:"audits,omitempty"`
+}
+
+func newExpertStatus(expert string, record *WriteRecord) *ExpertStatus {
+	return &ExpertStatus{
+		Expert:   expert,
+		Space:    record.Space,
+		Domain:   record.Domain,
+		Index:    record.Index,
+		Line:     record.Line,
+		Files:    len(record.History),
+		Missing:  missingIndexes(record),
+		GapSince: record.GapSince,
+		Failed:   record.Failed,
+		Rejected: record.Rejected,
+		Shadow:   record.Shadow,
+	}
+}
+
+func (t *replayTask) Experts() ([]*ExpertStatus, error) {
+	prefix := RecordKey("")
+	experts := []string{}
+	err := t.storage.Iterate(prefix, func(key []byte, value []byte) error {
+		experts = append(experts, strings.TrimPrefix(string(key), string(prefix)))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(experts)
+
+	status := make([]*ExpertStatus, 0, len(experts))
+	for _, expert := range experts {
+		record, err := t.expertRecord(expert)
+		if err != nil {
+			return nil, err
+		}
+		status = append(status, newExpertStatus(expert, record))
+	}
+	return status, nil
+}
+
+func (t *replayTask) Expert(expert string) (*ExpertStatus, error) {
+	if _, err := t.loadRecord(expert); err != nil {
+		return nil, err
+	}
+	record, err := t.expertRecord(expert)
+	if err != nil {
+		return nil, err
+	}
+	status := newExpertStatus(expert, record)
+	if status.Audits, err = Audits(t.storage, expert); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+func (t *replayTask) Advance(expert string, index int64, reason string) (*ExpertStatus, error) {
+	if _, err := t.loadRecord(expert); err != nil {
+		return nil, err
+	}
+	lk := t.expertLock(expert)
+	lk.Lock()
+	defer lk.Unlock()
+
+	record, err := t.expertRecord(expert)
+	if err != nil {
+		return nil, err
+	}
+	if index == 0 {
+		index = record.Index + 1
+	}
+	if index <= record.Index && record.Failed == "" {
+		return nil, xerrors.Errorf("index %d is not after the current index %d", index, record.Index)
+	}
+	if index < record.Index {
+		return nil, xerrors.Errorf("index %d is before the current index %d", index, record.Index)
+	}
+	if index == record.Index {
+		// resume a failed expert at its checkpoint.
+		if err := audit(t.storage, &AuditEntry{Expert: expert, Action: AuditAdvance, From: index, To: index, Reason: reason}); err != nil {
+			return nil, err
+		}
+		record.Failed = ""
+		record.GapSince = 0
+		if err := t.saveRecord(expert, record); err != nil {
+			return nil, err
+		}
+	} else if err := t.advance(expert, record, index, AuditAdvance, reason); err != nil {
+		return nil, err
+	}
+	log.Warnf("expert %s force advanced to index %d: %s", expert, index, reason)
+	return t.Expert(expert)
+}
+
+// Replayer returns the replay controls.
+func (t *TaskManager) Replayer() Replayer {
+	return t.replayTask
+}
+
+// IsNotFound reports whether err is about an unknown key.
+func IsNotFound(err error) bool {
+	return xerrors.Is(err, storage.ErrKeyNotFound)
+}
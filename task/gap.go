@@ -0,0 +1,165 @@
+package task
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/EpiK-Protocol/go-epik-gateway/app/config"
+	"github.com/EpiK-Protocol/go-epik-gateway/storage"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+const (
+	AuditGapSkip = "gap-skip"
+	AuditGapFail = "gap-fail"
+	AuditAdvance = "force-advance"
+	AuditReject  = "reject-fail"
+)
+
+var (
+	// ErrExpertFailed is returned for experts stopped by a gap or a statement
+	// rejected in strict mode until they are force advanced.
+	ErrExpertFailed = xerrors.New("expert replay failed")
+)
+
+// AuditEntry records a manual or policy change of an expert replay.
+type AuditEntry struct {
+	Time   int64  `json:"time"`
+	Expert string `json:"expert"`
+	Action string `json:"action"`
+	From   int64  `json:"from"`
+	To     int64  `json:"to"`
+	Reason string `json:"reason,omitempty"`
+}
+
+func AuditPrefix(expert string) []byte {
+	return []byte("task:replay:audit:" + expert + ":")
+}
+
+func audit(st storage.Storage, entry *AuditEntry) error {
+	entry.Time = time.Now().UnixNano()
+	bytes, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	key := append(AuditPrefix(entry.Expert), []byte(fmt.Sprintf("%020d", entry.Time))...)
+	return st.Put(key, bytes)
+}
+
+// Audits returns the audit entries of expert from the oldest.
+func Audits(st storage.Storage, expert string) ([]*AuditEntry, error) {
+	entries := []*AuditEntry{}
+	err := st.Iterate(AuditPrefix(expert), func(key []byte, value []byte) error {
+		var entry AuditEntry
+		if err := json.Unmarshal(value, &entry); err != nil {
+			return err
+		}
+		entries = append(entries, &entry)
+		return nil
+	})
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Time < entries[j].Time
+	})
+	return entries, err
+}
+
+// missingIndexes returns the indexes from the current one without file while
+// later indexes have.
+func missingIndexes(record *WriteRecord) []int64 {
+	last := int64(0)
+	for index := range record.History {
+		if index > last {
+			last = index
+		}
+	}
+	missing := []int64{}
+	for index := record.Index; index < last; index++ {
+		if _, ok := record.History[index]; !ok {
+			missing = append(missing, index)
+		}
+	}
+	return missing
+}
+
+// handleGap applies the gap policy when the current file index of expert is
+// missing.
+func (t *replayTask) handleGap(expert string, record *WriteRecord) error {
+	missing := missingIndexes(record)
+	if len(missing) == 0 {
+		log.WithFields(logrus.Fields{
+			"expert": expert,
+			"index":  record.Index,
+		}).Debug("wait for next nebula index file.")
+		return nil
+	}
+
+	now := time.Now()
+	if record.GapSince == 0 {
+		record.GapSince = now.Unix()
+		if err := t.saveRecord(expert, record); err != nil {
+			return err
+		}
+	}
+	fields := logrus.Fields{
+		"expert":  expert,
+		"index":   record.Index,
+		"missing": missing,
+		"since":   time.Unix(record.GapSince, 0),
+		"policy":  t.conf.Replay.GapPolicy,
+	}
+	if now.Sub(time.Unix(record.GapSince, 0)) < t.conf.Replay.GapWait || t.conf.Replay.GapPolicy == config.GapWait {
+		log.WithFields(fields).Warn("nebula index file not found.")
+		return nil
+	}
+
+	switch t.conf.Replay.GapPolicy {
+	case config.GapSkip:
+		to := record.Index
+		for _, index := range missing {
+			if index != to {
+				break
+			}
+			to++
+		}
+		reason := fmt.Sprintf("missing indexes %d-%d since %s", record.Index, to-1, time.Unix(record.GapSince, 0).Format(time.RFC3339))
+		if err := t.advance(expert, record, to, AuditGapSkip, reason); err != nil {
+			return err
+		}
+		log.WithFields(fields).Warn("skip missing nebula index files.")
+		return nil
+	case config.GapFail:
+		reason := fmt.Sprintf("missing index %d since %s", record.Index, time.Unix(record.GapSince, 0).Format(time.RFC3339))
+		if err := audit(t.storage, &AuditEntry{Expert: expert, Action: AuditGapFail, From: record.Index, To: record.Index, Reason: reason}); err != nil {
+			return err
+		}
+		record.Failed = reason
+		if err := t.saveRecord(expert, record); err != nil {
+			return err
+		}
+		log.WithFields(fields).Error("fail expert with missing nebula index file.")
+		return xerrors.Errorf("expert %s %s: %w", expert, reason, ErrExpertFailed)
+	}
+	return xerrors.Errorf("unknown gap policy: %s", t.conf.Replay.GapPolicy)
+}
+
+// advance moves the replay of expert to the start of file index with an
+// audit entry.
+func (t *replayTask) advance(expert string, record *WriteRecord, index int64, action string, reason string) error {
+	if err := audit(t.storage, &AuditEntry{Expert: expert, Action: action, From: record.Index, To: index, Reason: reason}); err != nil {
+		return err
+	}
+	for i := record.Index; i < index; i++ {
+		if err := t.clearJournal(expert, i); err != nil {
+			return err
+		}
+	}
+	record.Index = index
+	record.Line = 0
+	record.Hash = ""
+	record.GapSince = 0
+	record.Failed = ""
+	return t.saveRecord(expert, record)
+}
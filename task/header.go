@@ -0,0 +1,214 @@
+package task
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/EpiK-Protocol/go-epik-gateway/utils"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// FileVersionLegacy is the "domain:xxx,index:n" header without version, the
+	// domain is the value of the first pair and the index is optional.
+	FileVersionLegacy = 0
+	FileVersion1      = 1
+
+	FileVersionLatest = FileVersion1
+)
+
+// FileHeader is the first line of an expert data file, either a json object
+// or comma separated "key:value" pairs, eg:
+//
+//	{"version":1,"domain":"space","index":1,"lines":100,"checksum":"..."}
+//	version:1,domain:space,index:1,lines:100,checksum:...
+type FileHeader struct {
+	Version int    `json:"version"`
+	Domain  string `json:"domain"`
+	Index   int64  `json:"index"`
+
+	// count of lines after the header, zero if unknown.
+	Lines int64 `json:"lines,omitempty"`
+	// md5 of the lines after the header, each ends with "\n".
+	CheckSum string `json:"checksum,omitempty"`
+	// md5 of the CREATE lines after the header, each ends with "\n".
+	SchemaHash string `json:"schema_hash,omitempty"`
+}
+
+func parseFileHeader(line string) (*FileHeader, error) {
+	line = strings.TrimSpace(strings.TrimPrefix(line, "\ufeff"))
+	header := &FileHeader{}
+	if strings.HasPrefix(line, "{") {
+		if err := json.Unmarshal([]byte(line), header); err != nil {
+			return nil, xerrors.Errorf("invalid file header: %w", err)
+		}
+	} else if err := header.parsePairs(line); err != nil {
+		return nil, err
+	}
+	if err := header.validate(); err != nil {
+		return nil, err
+	}
+	return header, nil
+}
+
+func (h *FileHeader) parsePairs(line string) error {
+	first := ""
+	for i, pair := range strings.Split(line, ",") {
+		kv := strings.SplitN(pair, ":", 2)
+		if len(kv) != 2 {
+			return xerrors.Errorf("invalid file header pair: %q", pair)
+		}
+		key := strings.ToLower(strings.TrimSpace(kv[0]))
+		value := strings.TrimSpace(kv[1])
+		if i == 0 {
+			first = value
+		}
+		var err error
+		switch key {
+		case "version":
+			h.Version, err = strconv.Atoi(value)
+		case "domain":
+			h.Domain = value
+		case "index":
+			h.Index, err = strconv.ParseInt(value, 10, 64)
+		case "lines":
+			h.Lines, err = strconv.ParseInt(value, 10, 64)
+		case "checksum":
+			h.CheckSum = value
+		case "schema_hash":
+			h.SchemaHash = value
+		default:
+			// unknown keys are kept compatible with newer writers.
+		}
+		if err != nil {
+			return xerrors.Errorf("invalid file header %s: %w", key, err)
+		}
+	}
+	if h.Version == FileVersionLegacy && h.Domain == "" {
+		h.Domain = first
+	}
+	return nil
+}
+
+func (h *FileHeader) validate() error {
+	if h.Version < FileVersionLegacy || h.Version > FileVersionLatest {
+		return xerrors.Errorf("unsupported file header version: %d", h.Version)
+	}
+	if h.Index < 0 || (h.Index == 0 && h.Version != FileVersionLegacy) {
+		return xerrors.Errorf("invalid file header index: %d", h.Index)
+	}
+	if h.Lines < 0 {
+		return xerrors.Errorf("invalid file header lines: %d", h.Lines)
+	}
+	return nil
+}
+
+// validateFile checks the header of an expert data file and the line count and
+// hashes it declares, file.Index is set from the header when unknown.
+func validateFile(file *FileRef) (*FileHeader, error) {
+	fi, err := utils.OpenDecompressed(file.LocalPath)
+	if err != nil {
+		return nil, err
+	}
+	defer fi.Close()
+
+	br := bufio.NewReader(fi)
+	if magic, _ := br.Peek(len(parquetMagic)); bytes.Equal(magic, parquetMagic) {
+		return validateParquet(file)
+	}
+	line, err := br.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	header, err := parseFileHeader(line)
+	if err != nil {
+		return nil, xerrors.Errorf("file %s: %w", file.ID, err)
+	}
+	if err := checkFileIndex(file, header); err != nil {
+		return nil, err
+	}
+
+	if header.Lines == 0 && header.CheckSum == "" && header.SchemaHash == "" {
+		return header, nil
+	}
+
+	lines := int64(0)
+	var sum, schema hash.Hash = md5.New(), md5.New()
+	for {
+		content, err := br.ReadString('\n')
+		if len(content) > 0 {
+			content = strings.TrimRight(content, "\r\n")
+			lines++
+			io.WriteString(sum, content+"\n")
+			if strings.HasPrefix(strings.ToUpper(strings.TrimSpace(content)), "CREATE ") {
+				io.WriteString(schema, content+"\n")
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if header.Lines > 0 && header.Lines != lines {
+		return nil, xerrors.Errorf("file %s: header lines %d mismatch %d", file.ID, header.Lines, lines)
+	}
+	if header.CheckSum != "" && !strings.EqualFold(header.CheckSum, hex.EncodeToString(sum.Sum(nil))) {
+		return nil, xerrors.Errorf("file %s: header checksum mismatch", file.ID)
+	}
+	if header.SchemaHash != "" && !strings.EqualFold(header.SchemaHash, hex.EncodeToString(schema.Sum(nil))) {
+		return nil, xerrors.Errorf("file %s: header schema hash mismatch", file.ID)
+	}
+	return header, nil
+}
+
+// checkFileIndex matches the header index with file.Index, a legacy header
+// without index takes the one of file.
+func checkFileIndex(file *FileRef, header *FileHeader) error {
+	if header.Index == 0 {
+		header.Index = file.Index
+		return nil
+	}
+	if file.Index != 0 && file.Index != header.Index {
+		return xerrors.Errorf("file %s: header index %d mismatch %d", file.ID, header.Index, file.Index)
+	}
+	file.Index = header.Index
+	return nil
+}
+
+// validateParquet checks the header kept in the footer metadata of a parquet
+// file, its lines are the count of rows.
+func validateParquet(file *FileRef) (*FileHeader, error) {
+	pf, pr, err := openParquet(file.LocalPath)
+	if err != nil {
+		return nil, xerrors.Errorf("file %s: %w", file.ID, err)
+	}
+	defer pf.Close()
+	defer pr.ReadStop()
+
+	header, err := parquetHeader(pr)
+	if err != nil {
+		return nil, xerrors.Errorf("file %s: %w", file.ID, err)
+	}
+	if header == nil {
+		if file.Index == 0 {
+			return nil, xerrors.Errorf("file %s: parquet file without header", file.ID)
+		}
+		return &FileHeader{Index: file.Index}, nil
+	}
+	if err := checkFileIndex(file, header); err != nil {
+		return nil, err
+	}
+	if header.Lines > 0 && header.Lines != pr.GetNumRows() {
+		return nil, xerrors.Errorf("file %s: header lines %d mismatch %d", file.ID, header.Lines, pr.GetNumRows())
+	}
+	return header, nil
+}
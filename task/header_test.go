@@ -0,0 +1,78 @@
+package task
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseFileHeader(t *testing.T) {
+	tests := []struct {
+		line  string
+		valid bool
+		want  FileHeader
+	}{
+		{"domain:sp,index:1", true, FileHeader{Domain: "sp", Index: 1}},
+		{"\ufeffdomain:sp, index:2\r\n", true, FileHeader{Domain: "sp", Index: 2}},
+		// legacy headers take the domain from the first pair, the index is optional.
+		{"space:sp", true, FileHeader{Domain: "sp"}},
+		{"sp_key: sp,other:x", true, FileHeader{Domain: "sp"}},
+		{"index:3,domain:sp", true, FileHeader{Domain: "sp", Index: 3}},
+		{`{"domain":"sp"}`, true, FileHeader{Domain: "sp"}},
+		{"version:1,domain:sp,index:1,lines:2,checksum:ab", true, FileHeader{Version: 1, Domain: "sp", Index: 1, Lines: 2, CheckSum: "ab"}},
+		{`{"version":1,"domain":"sp","index":4,"schema_hash":"cd"}`, true, FileHeader{Version: 1, Domain: "sp", Index: 4, SchemaHash: "cd"}},
+		{"version:1,domain:sp", false, FileHeader{}},
+		{"version:2,domain:sp,index:1", false, FileHeader{}},
+		{"domain:sp,index:-1", false, FileHeader{}},
+		{"domain:sp,index:x", false, FileHeader{}},
+		{"domain:sp,lines:-1", false, FileHeader{}},
+		{`{"domain":`, false, FileHeader{}},
+	}
+	for _, tt := range tests {
+		header, err := parseFileHeader(tt.line)
+		if (err == nil) != tt.valid {
+			t.Fatalf("%q: %v", tt.line, err)
+		}
+		if err == nil && *header != tt.want {
+			t.Errorf("%q: got %+v", tt.line, *header)
+		}
+	}
+}
+
+func TestValidateFile(t *testing.T) {
+	body := "USE sp\nCREATE TAG t(v string)\n"
+	sum := md5.Sum([]byte(body))
+	schema := md5.Sum([]byte("CREATE TAG t(v string)\n"))
+	tests := []struct {
+		header string
+		index  int64
+		valid  bool
+		want   int64
+	}{
+		{"domain:sp", 5, true, 5},
+		{"domain:sp,index:5", 0, true, 5},
+		{"domain:sp,index:5", 5, true, 5},
+		{"domain:sp,index:5", 6, false, 0},
+		{"version:1,domain:sp,index:1,lines:2,checksum:" + hex.EncodeToString(sum[:]) + ",schema_hash:" + hex.EncodeToString(schema[:]), 1, true, 1},
+		{"version:1,domain:sp,index:1,lines:3", 1, false, 0},
+		{"version:1,domain:sp,index:1,checksum:00", 1, false, 0},
+		{"version:1,domain:sp,index:1,schema_hash:00", 1, false, 0},
+	}
+	dir := t.TempDir()
+	for _, tt := range tests {
+		path := filepath.Join(dir, "f")
+		if err := ioutil.WriteFile(path, []byte(tt.header+"\n"+body), 0644); err != nil {
+			t.Fatal(err)
+		}
+		file := &FileRef{ID: "f", Index: tt.index, LocalPath: path}
+		header, err := validateFile(file)
+		if (err == nil) != tt.valid {
+			t.Fatalf("%s: %v", tt.header, err)
+		}
+		if err == nil && (header.Index != tt.want || file.Index != tt.want) {
+			t.Errorf("%s: index %d, file %d", tt.header, header.Index, file.Index)
+		}
+	}
+}
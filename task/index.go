@@ -0,0 +1,253 @@
+package task
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/EpiK-Protocol/go-epik-gateway/app/config"
+	"github.com/EpiK-Protocol/go-epik-gateway/graph"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+const (
+	jobBackoffMin = 500 * time.Millisecond
+	jobBackoffMax = 5 * time.Second
+)
+
+const (
+	RebuildTag      = "TAG"
+	RebuildEdge     = "EDGE"
+	RebuildFullText = "FULLTEXT"
+
+	JobStatusFinished = "FINISHED"
+	JobStatusFailed   = "FAILED"
+	JobStatusStopped  = "STOPPED"
+)
+
+// IndexRebuild is an index rebuild pending on a space after import.
+type IndexRebuild struct {
+	Space string
+	Kind  string
+	// nebula job id, zero before the rebuild is submitted.
+	Job int64
+}
+
+// legacyIndexFields are indexed when no rule matches a tag or edge.
+var legacyIndexFields = map[graph.StatementKind]config.IndexField{
+	graph.StatementCreateTag:  {Name: "value", Length: 16},
+	graph.StatementCreateEdge: {Name: "name", Length: 16},
+}
+
+func matchIndexRule(rules []config.IndexRule, expert string, space string, stmt *graph.Statement) *config.IndexRule {
+	schema := strings.ToLower(strings.TrimPrefix(string(stmt.Kind), "CREATE "))
+	for i := range rules {
+		rule := &rules[i]
+		if (rule.Expert == "" || rule.Expert == expert) &&
+			(rule.Space == "" || rule.Space == space) &&
+			(rule.Schema == "" || strings.ToLower(rule.Schema) == schema) &&
+			(rule.Name == "" || rule.Name == stmt.Name) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// indexStatements returns the indexes created along with the tag or edge of
+// stmt and the kind of rebuild they need.
+func (t *replayTask) indexStatements(expert string, space string, stmt *graph.Statement) ([]*graph.Statement, string) {
+	if stmt.Kind != graph.StatementCreateTag && stmt.Kind != graph.StatementCreateEdge {
+		return nil, ""
+	}
+	schema := strings.TrimPrefix(string(stmt.Kind), "CREATE ")
+
+	fields := []config.IndexField{legacyIndexFields[stmt.Kind]}
+	fullText := false
+	if rule := matchIndexRule(t.conf.Replay.Indexes, expert, space, stmt); rule != nil {
+		if rule.Skip {
+			return nil, ""
+		}
+		fields = rule.Fields
+		fullText = rule.FullText
+	}
+
+	// types by property.
+	props := map[string]string{}
+	for i, prop := range stmt.Props[stmt.Name] {
+		if i < len(stmt.Types) {
+			props[prop] = stmt.Types[i]
+		}
+	}
+	stmts := []string{}
+	for _, field := range fields {
+		typ, ok := props[field.Name]
+		if !ok {
+			log.WithFields(logrus.Fields{
+				"expert": expert,
+				"space":  space,
+				"name":   stmt.Name,
+				"field":  field.Name,
+			}).Debug("skip index of missing property.")
+			continue
+		}
+		prop := graph.QuoteIdent(field.Name)
+		if fullText {
+			index := graph.QuoteIdent(fmt.Sprintf("nebula_%s_%s", stmt.Name, field.Name))
+			stmts = append(stmts, fmt.Sprintf("CREATE FULLTEXT %s INDEX %s ON %s(%s);", schema, index, graph.QuoteIdent(stmt.Name), prop))
+			continue
+		}
+		// only variable strings take an index length.
+		if field.Length > 0 && strings.EqualFold(strings.TrimSpace(typ), "string") {
+			prop = fmt.Sprintf("%s(%d)", prop, field.Length)
+		}
+		index := graph.QuoteIdent(fmt.Sprintf("i_%s_%s", stmt.Name, field.Name))
+		stmts = append(stmts, fmt.Sprintf("CREATE %s INDEX IF NOT EXISTS %s ON %s(%s);", schema, index, graph.QuoteIdent(stmt.Name), prop))
+	}
+	if len(stmts) == 0 {
+		return nil, ""
+	}
+	indexes, err := graph.ParseNGQL(strings.Join(stmts, ""))
+	if err != nil {
+		log.Errorf("failed to parse index statements of %s:%v", stmt.Name, err)
+		return nil, ""
+	}
+	if fullText {
+		// nebula has no IF NOT EXISTS for full-text indexes, the stores
+		// tolerate existing ones of statements marked so.
+		for _, index := range indexes {
+			index.IfNotExists = true
+		}
+		return indexes, RebuildFullText
+	}
+	return indexes, schema
+}
+
+// rebuildKinds returns the index rebuilds needed once stmts are imported.
+func (t *replayTask) rebuildKinds(expert string, space string, stmts []*graph.Statement) []string {
+	kinds := []string{}
+	for _, stmt := range stmts {
+		switch stmt.Kind {
+		case graph.StatementCreateTagIndex:
+			kinds = append(kinds, RebuildTag)
+		case graph.StatementCreateEdgeIndex:
+			kinds = append(kinds, RebuildEdge)
+		default:
+			if _, kind := t.indexStatements(expert, space, stmt); kind != "" {
+				kinds = append(kinds, kind)
+			}
+		}
+	}
+	return kinds
+}
+
+func (r *WriteRecord) markRebuild(space string, kind string) {
+	for _, rebuild := range r.Rebuilds {
+		if rebuild.Space == space && rebuild.Kind == kind && rebuild.Job == 0 {
+			return
+		}
+	}
+	r.Rebuilds = append(r.Rebuilds, &IndexRebuild{Space: space, Kind: kind})
+}
+
+// rebuildDue reports whether file is the last known one of its expert, the
+// pending index rebuilds run once the expert caught up instead of after each
+// file.
+func (t *replayTask) rebuildDue(file *FileRef, record *WriteRecord) bool {
+	for index := range record.History {
+		if index > file.Index {
+			return false
+		}
+	}
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	for _, f := range t.files {
+		if f.Expert == file.Expert && f.Index > file.Index {
+			return false
+		}
+	}
+	return true
+}
+
+// rebuildIndexes submits the pending index rebuilds of record and waits for
+// their jobs, a job still running on timeout is tracked again on next call.
+func (t *replayTask) rebuildIndexes(expert string, record *WriteRecord) error {
+	for len(record.Rebuilds) > 0 {
+		rebuild := record.Rebuilds[0]
+		if rebuild.Job == 0 {
+			job, err := t.submitRebuild(expert, rebuild)
+			if err != nil {
+				return err
+			}
+			rebuild.Job = job
+			if err := t.saveRecord(expert, record); err != nil {
+				return err
+			}
+			log.WithFields(logrus.Fields{
+				"expert": expert,
+				"space":  rebuild.Space,
+				"kind":   rebuild.Kind,
+				"job":    job,
+			}).Info("submit nebula index rebuild.")
+		}
+		if rebuild.Job > 0 {
+			if err := t.waitJob(expert, rebuild); err != nil {
+				return err
+			}
+		}
+		record.Rebuilds = record.Rebuilds[1:]
+		if err := t.saveRecord(expert, record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// submitRebuild returns the rebuild job id, or -1 when nebula creates none.
+func (t *replayTask) submitRebuild(expert string, rebuild *IndexRebuild) (int64, error) {
+	return t.store.RebuildIndex(t.nebulaSpace(expert, rebuild.Space), rebuild.Kind)
+}
+
+func (t *replayTask) waitJob(expert string, rebuild *IndexRebuild) error {
+	status, err := t.awaitJob(expert, rebuild.Space, rebuild.Job, "index rebuild")
+	if err != nil {
+		return err
+	}
+	if status != JobStatusFinished {
+		job := rebuild.Job
+		rebuild.Job = 0
+		return xerrors.Errorf("index rebuild job %d of space %s %s", job, rebuild.Space, strings.ToLower(status))
+	}
+	log.WithFields(logrus.Fields{
+		"expert": expert,
+		"space":  rebuild.Space,
+		"kind":   rebuild.Kind,
+		"job":    rebuild.Job,
+	}).Info("nebula index rebuilt.")
+	return nil
+}
+
+// awaitJob polls a job of space until it finished, failed or stopped, up to
+// the rebuild timeout.
+func (t *replayTask) awaitJob(expert string, space string, job int64, name string) (string, error) {
+	timeout := t.conf.Replay.RebuildTimeout
+	deadline := time.Now().Add(timeout)
+	backoff := jobBackoffMin
+	for {
+		status, err := t.store.JobStatus(t.nebulaSpace(expert, space), job)
+		if err != nil {
+			return "", err
+		}
+		switch status {
+		case JobStatusFinished, JobStatusFailed, JobStatusStopped:
+			return status, nil
+		}
+		if time.Now().After(deadline) {
+			return "", xerrors.Errorf("%s job %d of space %s not finished after %s", name, job, space, timeout)
+		}
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > jobBackoffMax {
+			backoff = jobBackoffMax
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package task
+
+import (
+	"testing"
+
+	"github.com/EpiK-Protocol/go-epik-gateway/app/config"
+	"github.com/EpiK-Protocol/go-epik-gateway/graph"
+)
+
+func TestIndexStatements(t *testing.T) {
+	conf := config.Config{}
+	conf.Replay.Indexes = []config.IndexRule{
+		{Name: "doc", FullText: true, Fields: []config.IndexField{{Name: "body"}}},
+		{Name: "person", Fields: []config.IndexField{{Name: "name", Length: 32}, {Name: "age", Length: 8}, {Name: "phone"}}},
+		{Name: "skipped", Skip: true},
+	}
+	task, _ := newTestReplay(t, conf)
+	tests := []struct {
+		sql  string
+		want string
+		kind string
+	}{
+		{"CREATE TAG t(value string)", "CREATE TAG INDEX IF NOT EXISTS i_t_value ON t(value(16));", RebuildTag},
+		{"CREATE TAG t(value int)", "CREATE TAG INDEX IF NOT EXISTS i_t_value ON t(value);", RebuildTag},
+		{"CREATE EDGE e(name fixed_string(8))", "CREATE EDGE INDEX IF NOT EXISTS i_e_name ON e(name);", RebuildEdge},
+		{"CREATE EDGE e(weight int)", "", ""},
+		{"CREATE TAG person(name string, age int)", "CREATE TAG INDEX IF NOT EXISTS i_person_name ON person(name(32));CREATE TAG INDEX IF NOT EXISTS i_person_age ON person(age);", RebuildTag},
+		{"CREATE TAG doc(body string)", "CREATE FULLTEXT TAG INDEX nebula_doc_body ON doc(body);", RebuildFullText},
+		{"CREATE TAG skipped(value string)", "", ""},
+	}
+	for _, tt := range tests {
+		indexes, kind := task.indexStatements("e", "sp", parseNGQL(t, tt.sql)[0])
+		if got := graph.Render(indexes); got != tt.want || kind != tt.kind {
+			t.Errorf("%s: got %s %s", tt.sql, got, kind)
+		}
+		if kind == RebuildFullText && !indexes[0].IfNotExists {
+			t.Errorf("%s: full-text index not marked if not exists", tt.sql)
+		}
+	}
+}
+
+func TestFullTextIndexExisted(t *testing.T) {
+	conf := config.Config{}
+	conf.Replay.Indexes = []config.IndexRule{{FullText: true, Fields: []config.IndexField{{Name: "value"}}}}
+	task, _ := newTestReplay(t, conf)
+	sql := "CREATE SPACE IF NOT EXISTS sp(vid_type=FIXED_STRING(8));USE sp;CREATE TAG IF NOT EXISTS t(value string)"
+	for i := 0; i < 2; i++ {
+		if err := task.writeToNebulaSql("e", 2, "sp", parseNGQL(t, sql), false); err != nil {
+			t.Fatalf("write %d: %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package task
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/EpiK-Protocol/go-epik-gateway/app/config"
+	"github.com/EpiK-Protocol/go-epik-gateway/graph"
+	"github.com/EpiK-Protocol/go-epik-gateway/storage"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+const (
+	JournalPending = "pending"
+	JournalApplied = "applied"
+	JournalSkipped = "skipped"
+)
+
+var (
+	// ErrInDoubt is returned for pending lines which can't be executed twice
+	// and may have been applied before a crash.
+	ErrInDoubt = xerrors.New("replay lines in doubt")
+)
+
+// JournalEntry records lines of an expert file sent to nebula, it's pending
+// until the lines are checkpointed in the same write.
+type JournalEntry struct {
+	Index int64
+	Start int64
+	End   int64
+	// hash of the end line.
+	Hash string
+	// executing the lines twice is harmless.
+	Idempotent bool
+	Status     string
+	Time       int64
+}
+
+func JournalPrefix(expert string, index int64) []byte {
+	return []byte(fmt.Sprintf("task:replay:journal:%s:%020d:", expert, index))
+}
+
+func JournalKey(expert string, index int64, start int64) []byte {
+	return []byte(fmt.Sprintf("%s%020d", JournalPrefix(expert, index), start))
+}
+
+// lineHash is the statement hash of a replayed line.
+func lineHash(content string) string {
+	sum := md5.Sum([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func (t *replayTask) saveJournal(expert string, entry *JournalEntry) error {
+	bytes, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return t.storage.Put(JournalKey(expert, entry.Index, entry.Start), bytes)
+}
+
+// commitJournal checkpoints record at the end line of entry and closes entry
+// in one write.
+func (t *replayTask) commitJournal(expert string, record *WriteRecord, entry *JournalEntry, status string) error {
+	entry.Status = status
+	entry.Time = time.Now().Unix()
+	record.Line = entry.End
+	record.Hash = entry.Hash
+	jbytes, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	rbytes, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return t.storage.Write(
+		storage.Entry{Key: JournalKey(expert, entry.Index, entry.Start), Value: jbytes},
+		storage.Entry{Key: RecordKey(expert), Value: rbytes},
+	)
+}
+
+// applyLines executes lines start to end of the current file through the
+// journal, record is checkpointed at end once apply succeeds. Lines which
+// can't be executed twice are only left pending when their outcome is
+// unknown, others are redone anyway.
+func (t *replayTask) applyLines(expert string, record *WriteRecord, start int64, end int64, hash string, idem bool, apply func() error) error {
+	entry := &JournalEntry{
+		Index:      record.Index,
+		Start:      start,
+		End:        end,
+		Hash:       hash,
+		Idempotent: idem,
+		Status:     JournalPending,
+		Time:       time.Now().Unix(),
+	}
+	if err := t.saveJournal(expert, entry); err != nil {
+		return err
+	}
+	if err := apply(); err != nil {
+		if !idem && notApplied(err) {
+			if derr := t.storage.Del(JournalKey(expert, entry.Index, entry.Start)); derr != nil {
+				log.Errorf("failed to remove replay journal:%v", derr)
+			}
+		}
+		return err
+	}
+	return t.commitJournal(expert, record, entry, JournalApplied)
+}
+
+// partlyApplied is a failure of lines after some of their statements were
+// applied.
+type partlyApplied struct {
+	err error
+}
+
+func (e *partlyApplied) Error() string { return e.err.Error() }
+
+func (e *partlyApplied) Unwrap() error { return e.err }
+
+// notApplied reports whether nothing of the lines failing with err was
+// applied.
+func notApplied(err error) bool {
+	var partly *partlyApplied
+	return graph.NotApplied(err) && !xerrors.As(err, &partly)
+}
+
+// Journal returns the journal entries of the file index of expert.
+func Journal(st storage.Storage, expert string, index int64) ([]*JournalEntry, error) {
+	entries := []*JournalEntry{}
+	err := st.Iterate(JournalPrefix(expert, index), func(key []byte, value []byte) error {
+		var entry JournalEntry
+		if err := json.Unmarshal(value, &entry); err != nil {
+			return err
+		}
+		entries = append(entries, &entry)
+		return nil
+	})
+	return entries, err
+}
+
+// recoverJournal resolves the lines left pending after the checkpoint of
+// record, the returned entry needs to be redone.
+func (t *replayTask) recoverJournal(expert string, record *WriteRecord) (*JournalEntry, error) {
+	entries, err := Journal(t.storage, expert, record.Index)
+	if err != nil {
+		return nil, err
+	}
+	var pending *JournalEntry
+	for _, entry := range entries {
+		if entry.Status == JournalPending && entry.Start > record.Line {
+			pending = entry
+		}
+	}
+	if pending == nil || pending.Idempotent {
+		return pending, nil
+	}
+
+	fields := logrus.Fields{
+		"expert": expert,
+		"index":  pending.Index,
+		"start":  pending.Start,
+		"end":    pending.End,
+		"policy": t.conf.Replay.InDoubt,
+	}
+	switch t.conf.Replay.InDoubt {
+	case config.InDoubtRetry:
+		log.WithFields(fields).Warn("redo replay lines in doubt.")
+		return pending, nil
+	case config.InDoubtSkip:
+		log.WithFields(fields).Warn("skip replay lines in doubt.")
+		return nil, t.commitJournal(expert, record, pending, JournalSkipped)
+	}
+	return nil, xerrors.Errorf("expert %s index %d lines %d-%d: %w", expert, pending.Index, pending.Start, pending.End, ErrInDoubt)
+}
+
+// clearJournal removes the journal of a replayed file.
+func (t *replayTask) clearJournal(expert string, index int64) error {
+	entries, err := Journal(t.storage, expert, index)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := t.storage.Del(JournalKey(expert, index, entry.Start)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clearJournals removes the journals of all files of expert.
+func (t *replayTask) clearJournals(expert string) error {
+	entries := []storage.Entry{}
+	err := t.storage.Iterate([]byte("task:replay:journal:"+expert+":"), func(key []byte, value []byte) error {
+		entries = append(entries, storage.Entry{Key: key})
+		return nil
+	})
+	if err != nil || len(entries) == 0 {
+		return err
+	}
+	return t.storage.Write(entries...)
+}
@@ -0,0 +1,223 @@
+package task
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/EpiK-Protocol/go-epik-gateway/app/config"
+	"github.com/EpiK-Protocol/go-epik-gateway/graph"
+	"github.com/EpiK-Protocol/go-epik-gateway/storage"
+	"golang.org/x/xerrors"
+)
+
+var errCrash = xerrors.New("crash")
+
+// crashStore applies upserts, then fails the crash-th one as if the gateway
+// stopped before checkpointing it.
+type crashStore struct {
+	*graph.MemoryStore
+	crash int
+	// returned instead of applying the crash-th upsert when set.
+	refuse  error
+	upserts int
+}
+
+func (s *crashStore) Upsert(space string, stmts []*graph.Statement) error {
+	s.upserts++
+	if s.upserts == s.crash && s.refuse != nil {
+		return s.refuse
+	}
+	if err := s.MemoryStore.Upsert(space, stmts); err != nil {
+		return err
+	}
+	if s.upserts == s.crash {
+		return errCrash
+	}
+	return nil
+}
+
+// crashReplay replays the file of lines until its crash-th upsert crashes.
+func crashReplay(t *testing.T, crash int, lines ...string) (storage.Storage, *crashStore, *FileRef) {
+	st, err := storage.NewMemoryStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &crashStore{MemoryStore: graph.NewMemoryStore(), crash: crash}
+	file := writeExpertFile(t, st, "ex", 1, lines...)
+	if err := newTestReplayOn(t, config.Config{}, st, store).replayFile(file); !xerrors.Is(err, errCrash) {
+		t.Fatalf("replay didn't crash: %v", err)
+	}
+	entries, err := Journal(st, "ex", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pendingEntry(entries) == nil {
+		t.Fatal("no pending journal entry")
+	}
+	return st, store, file
+}
+
+func pendingEntry(entries []*JournalEntry) *JournalEntry {
+	for _, entry := range entries {
+		if entry.Status == JournalPending {
+			return entry
+		}
+	}
+	return nil
+}
+
+var journalSchema = "CREATE SPACE IF NOT EXISTS sp(vid_type=FIXED_STRING(8));USE sp;CREATE TAG t(v string)"
+
+func TestJournalRedo(t *testing.T) {
+	st, store, file := crashReplay(t, 1, "domain:sp,index:1", journalSchema, `INSERT VERTEX t(v) VALUES "a":("A")`)
+	task := newTestReplayOn(t, config.Config{}, st, store)
+	record, err := task.expertRecord("ex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Line != 2 {
+		t.Fatalf("checkpointed line %d", record.Line)
+	}
+	redo, err := task.recoverJournal("ex", record)
+	if err != nil || redo == nil || !redo.Idempotent || redo.Start != 3 {
+		t.Fatalf("redo %+v, %v", redo, err)
+	}
+	if err := task.replayFile(file); err != nil {
+		t.Fatal(err)
+	}
+	if record.Index != 2 || store.upserts != 2 {
+		t.Errorf("index %d, upserts %d", record.Index, store.upserts)
+	}
+	stats, err := store.Stats("sp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Vertices != 1 {
+		t.Errorf("vertices %d", stats.Vertices)
+	}
+}
+
+func TestJournalInDoubt(t *testing.T) {
+	tests := []struct {
+		policy  string
+		failed  bool
+		upserts int
+	}{
+		{"", true, 2},
+		{config.InDoubtFail, true, 2},
+		{config.InDoubtRetry, false, 4},
+		{config.InDoubtSkip, false, 3},
+	}
+	for _, tt := range tests {
+		st, store, file := crashReplay(t, 2, "domain:sp,index:1", journalSchema+`;INSERT VERTEX t(v) VALUES "a":("A")`,
+			`UPSERT VERTEX ON t "a" SET v = "B"`, `INSERT VERTEX t(v) VALUES "b":("B")`)
+		conf := config.Config{}
+		conf.Replay.InDoubt = tt.policy
+		task := newTestReplayOn(t, conf, st, store)
+		err := task.replayFile(file)
+		if tt.failed != xerrors.Is(err, ErrInDoubt) {
+			t.Fatalf("%q: %v", tt.policy, err)
+		}
+		if !tt.failed && err != nil {
+			t.Fatalf("%q: %v", tt.policy, err)
+		}
+		if store.upserts != tt.upserts {
+			t.Errorf("%q: upserts %d", tt.policy, store.upserts)
+		}
+		record, err := task.expertRecord("ex")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.failed && (record.Index != 1 || record.Line != 2) {
+			t.Errorf("%q: record moved to %d:%d", tt.policy, record.Index, record.Line)
+		}
+		if !tt.failed && record.Index != 2 {
+			t.Errorf("%q: record index %d", tt.policy, record.Index)
+		}
+	}
+}
+
+func TestJournalSkipCommits(t *testing.T) {
+	st, store, _ := crashReplay(t, 2, "domain:sp,index:1", journalSchema+`;INSERT VERTEX t(v) VALUES "a":("A")`,
+		`UPSERT VERTEX ON t "a" SET v = "B"`)
+	conf := config.Config{}
+	conf.Replay.InDoubt = config.InDoubtSkip
+	task := newTestReplayOn(t, conf, st, store)
+	record, err := task.expertRecord("ex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	redo, err := task.recoverJournal("ex", record)
+	if err != nil || redo != nil {
+		t.Fatalf("redo %+v, %v", redo, err)
+	}
+	saved, err := task.loadRecord("ex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Line != 3 || saved.Hash != lineHash(`UPSERT VERTEX ON t "a" SET v = "B"`) {
+		t.Errorf("skipped lines not checkpointed: %d %s", saved.Line, saved.Hash)
+	}
+	entries, err := Journal(st, "ex", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	skipped := false
+	for _, entry := range entries {
+		skipped = skipped || entry.Start == 3 && entry.Status == JournalSkipped
+	}
+	if !skipped {
+		t.Error("in doubt entry not skipped")
+	}
+}
+
+func TestJournalChangedFile(t *testing.T) {
+	st, store, file := crashReplay(t, 1, "domain:sp,index:1", journalSchema, `INSERT VERTEX t(v) VALUES "a":("A")`)
+	changed := strings.Join([]string{"domain:sp,index:1", journalSchema + ";CREATE TAG u(v string)", `INSERT VERTEX t(v) VALUES "a":("A")`}, "\n")
+	if err := ioutil.WriteFile(file.LocalPath, []byte(changed), 0644); err != nil {
+		t.Fatal(err)
+	}
+	task := newTestReplayOn(t, config.Config{}, st, store)
+	err := task.replayFile(file)
+	if err == nil || !strings.Contains(err.Error(), "differs from the replay checkpoint") {
+		t.Fatalf("changed file resumed: %v", err)
+	}
+	if store.upserts != 1 {
+		t.Errorf("upserts %d", store.upserts)
+	}
+}
+
+func TestJournalNotApplied(t *testing.T) {
+	tests := []struct {
+		line    string
+		pending bool
+	}{
+		{`UPSERT VERTEX ON t "a" SET v = "B"`, false},
+		// the tag is created before the refused upsert.
+		{`CREATE TAG IF NOT EXISTS u(v string);UPSERT VERTEX ON t "a" SET v = "B"`, true},
+	}
+	for _, tt := range tests {
+		st, err := storage.NewMemoryStorage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		refuse := xerrors.Errorf("session: %w", graph.ErrNotSent)
+		store := &crashStore{MemoryStore: graph.NewMemoryStore(), crash: 2, refuse: refuse}
+		file := writeExpertFile(t, st, "ex", 1, "domain:sp,index:1", journalSchema+`;INSERT VERTEX t(v) VALUES "a":("A")`, tt.line)
+		if err := newTestReplayOn(t, config.Config{}, st, store).replayFile(file); !xerrors.Is(err, graph.ErrNotSent) {
+			t.Fatalf("%s: %v", tt.line, err)
+		}
+		entries, err := Journal(st, "ex", 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pending := pendingEntry(entries) != nil; pending != tt.pending {
+			t.Fatalf("%s: pending %v", tt.line, pending)
+		}
+		err = newTestReplayOn(t, config.Config{}, st, store).replayFile(file)
+		if tt.pending != xerrors.Is(err, ErrInDoubt) {
+			t.Errorf("%s: %v", tt.line, err)
+		}
+	}
+}
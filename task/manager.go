@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/EpiK-Protocol/go-epik-gateway/app/config"
+	"github.com/EpiK-Protocol/go-epik-gateway/graph"
 	"github.com/EpiK-Protocol/go-epik-gateway/storage"
 	"github.com/EpiK-Protocol/go-epik-gateway/utils/logging"
 	"github.com/asaskevich/EventBus"
@@ -23,24 +24,41 @@ type TaskManager struct {
 	retrieveTask *retrieveTask
 	replayTask   *replayTask
 
+	retentionTask *retentionTask
+
 	stop chan bool
 }
 
-func NewTask(conf config.Config, st storage.Storage, bus EventBus.Bus) (Task, error) {
+func NewTask(conf config.Config, st storage.Storage, bus EventBus.Bus, store graph.GraphStore) (Task, error) {
+
+	initLog()
+
+	limiter, err := newTransferLimiter(conf.Transfer)
+	if err != nil {
+		return nil, err
+	}
 
-	log = logging.Log()
+	client, err := newHTTPClient(conf.Server.HTTPClient)
+	if err != nil {
+		return nil, err
+	}
 
-	downloadTask, err := newDownloadTask(conf, st, bus)
+	downloadTask, err := newDownloadTask(conf, st, bus, client, limiter)
 	if err != nil {
 		return nil, err
 	}
 
-	retrieveTask, err := newRetrieveTask(conf, st, bus)
+	retrieveTask, err := newRetrieveTask(conf, st, bus, limiter)
 	if err != nil {
 		return nil, err
 	}
 
-	replayTask, err := newReplayTask(conf, st, bus)
+	replayTask, err := newReplayTask(conf, st, bus, store)
+	if err != nil {
+		return nil, err
+	}
+
+	retentionTask, err := newRetentionTask(conf, st, bus)
 	if err != nil {
 		return nil, err
 	}
@@ -52,9 +70,17 @@ func NewTask(conf config.Config, st storage.Storage, bus EventBus.Bus) (Task, er
 		downloadTask: downloadTask,
 		retrieveTask: retrieveTask,
 		replayTask:   replayTask,
+
+		retentionTask: retentionTask,
 	}, nil
 }
 
+func initLog() {
+	if log == nil {
+		log = logging.Log()
+	}
+}
+
 func (t *TaskManager) Start(ctx context.Context) error {
 	log.Info("start task.")
 	if t.stop != nil {
@@ -74,7 +100,16 @@ func (t *TaskManager) process(ctx context.Context) {
 		default:
 		}
 
-		if t.config.Server.EnableDownload {
+		if err := t.retentionTask.process(ctx); err != nil {
+			log.Errorf("failed to apply retention: %v", err)
+		}
+
+		if !hasFreeSpace(t.config) {
+			log.WithFields(logrus.Fields{
+				"dir": t.config.Storage.DataDir,
+				"min": t.config.Storage.MinFreeSpace,
+			}).Warn("low free space, pause intake.")
+		} else if t.config.Server.EnableDownload {
 			go func() {
 				if err := t.downloadTask.process(ctx); err != nil {
 					log.Errorf("failed to download: %v", err)
@@ -117,6 +152,7 @@ func (t *TaskManager) Stop(ctx context.Context) error {
 	t.downloadTask.stop()
 	t.retrieveTask.stop()
 	t.replayTask.stop()
+	t.retentionTask.stop()
 
 	return nil
 }
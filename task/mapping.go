@@ -0,0 +1,369 @@
+package task
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/EpiK-Protocol/go-epik-gateway/app/config"
+	"github.com/EpiK-Protocol/go-epik-gateway/graph"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+const (
+	PropString    = "string"
+	PropInt       = "int"
+	PropDouble    = "double"
+	PropBool      = "bool"
+	PropDate      = "date"
+	PropTime      = "time"
+	PropDateTime  = "datetime"
+	PropTimestamp = "timestamp"
+
+	VIDString = "string"
+	VIDInt    = "int"
+)
+
+// propSchemaTypes are the nebula types of mapped property types.
+var propSchemaTypes = map[string]string{
+	PropString:    "string",
+	PropInt:       "int64",
+	PropDouble:    "double",
+	PropBool:      "bool",
+	PropDate:      "date",
+	PropTime:      "time",
+	PropDateTime:  "datetime",
+	PropTimestamp: "timestamp",
+}
+
+func validateMapping(mapping config.Mapping) error {
+	switch mapping.Format {
+	case config.FormatCSV, config.FormatJSONL, config.FormatParquet:
+	default:
+		return xerrors.Errorf("unknown data format: %q", mapping.Format)
+	}
+	switch mapping.VIDType {
+	case "", VIDString, VIDInt:
+	default:
+		return xerrors.Errorf("unknown vid type: %q", mapping.VIDType)
+	}
+	if len(mapping.Vertices) == 0 && len(mapping.Edges) == 0 {
+		return xerrors.New("mapping has no vertices nor edges")
+	}
+	for _, v := range mapping.Vertices {
+		if v.Tag == "" || v.VID == "" {
+			return xerrors.Errorf("vertex mapping needs tag and vid: %+v", v)
+		}
+		if err := validateProps(v.Props); err != nil {
+			return xerrors.Errorf("tag %s: %w", v.Tag, err)
+		}
+	}
+	for _, e := range mapping.Edges {
+		if e.Edge == "" || e.Src == "" || e.Dst == "" {
+			return xerrors.Errorf("edge mapping needs edge, src and dst: %+v", e)
+		}
+		if err := validateProps(e.Props); err != nil {
+			return xerrors.Errorf("edge %s: %w", e.Edge, err)
+		}
+	}
+	return nil
+}
+
+func validateProps(props []config.PropMapping) error {
+	for _, prop := range props {
+		if prop.Name == "" {
+			return xerrors.New("property without name")
+		}
+		if _, ok := propSchemaTypes[propType(prop)]; !ok {
+			return xerrors.Errorf("property %s has unknown type: %q", prop.Name, prop.Type)
+		}
+	}
+	return nil
+}
+
+func propType(prop config.PropMapping) string {
+	if prop.Type == "" {
+		return PropString
+	}
+	return strings.ToLower(prop.Type)
+}
+
+func propColumn(prop config.PropMapping) string {
+	if prop.Column == "" {
+		return prop.Name
+	}
+	return prop.Column
+}
+
+// mappingSchema returns the statements creating the mapped tags and edges.
+func mappingSchema(mapping config.Mapping) string {
+	var b strings.Builder
+	created := map[string]bool{}
+	create := func(schema string, name string, props []config.PropMapping) {
+		if created[schema+name] {
+			return
+		}
+		created[schema+name] = true
+		defs := make([]string, 0, len(props))
+		for _, prop := range props {
+			defs = append(defs, fmt.Sprintf("%s %s", graph.QuoteIdent(prop.Name), propSchemaTypes[propType(prop)]))
+		}
+		b.WriteString(fmt.Sprintf("CREATE %s IF NOT EXISTS %s(%s);", schema, graph.QuoteIdent(name), strings.Join(defs, ", ")))
+	}
+	for _, v := range mapping.Vertices {
+		create("TAG", v.Tag, v.Props)
+	}
+	for _, e := range mapping.Edges {
+		create("EDGE", e.Edge, e.Props)
+	}
+	return b.String()
+}
+
+// mappingStatements returns the inserts of a record, mappings missing their
+// key columns in the record are skipped.
+func mappingStatements(mapping config.Mapping, row map[string]interface{}) (string, error) {
+	var b strings.Builder
+	for _, v := range mapping.Vertices {
+		vid, ok, err := vidLiteral(mapping, row, v.VID)
+		if err != nil {
+			return "", xerrors.Errorf("tag %s: %w", v.Tag, err)
+		}
+		if !ok {
+			continue
+		}
+		names, values, err := propLiterals(v.Props, row)
+		if err != nil {
+			return "", xerrors.Errorf("tag %s: %w", v.Tag, err)
+		}
+		b.WriteString(fmt.Sprintf("INSERT VERTEX %s(%s) VALUES %s:(%s);", graph.QuoteIdent(v.Tag), names, vid, values))
+	}
+	for _, e := range mapping.Edges {
+		src, ok, err := vidLiteral(mapping, row, e.Src)
+		if err != nil {
+			return "", xerrors.Errorf("edge %s: %w", e.Edge, err)
+		}
+		dst, ok2, err := vidLiteral(mapping, row, e.Dst)
+		if err != nil {
+			return "", xerrors.Errorf("edge %s: %w", e.Edge, err)
+		}
+		if !ok || !ok2 {
+			continue
+		}
+		if e.Rank != "" {
+			if rank, ok := row[e.Rank]; ok && valueString(rank) != "" {
+				r, err := strconv.ParseInt(valueString(rank), 10, 64)
+				if err != nil {
+					return "", xerrors.Errorf("edge %s rank: %w", e.Edge, err)
+				}
+				dst = fmt.Sprintf("%s@%d", dst, r)
+			}
+		}
+		names, values, err := propLiterals(e.Props, row)
+		if err != nil {
+			return "", xerrors.Errorf("edge %s: %w", e.Edge, err)
+		}
+		b.WriteString(fmt.Sprintf("INSERT EDGE %s(%s) VALUES %s->%s:(%s);", graph.QuoteIdent(e.Edge), names, src, dst, values))
+	}
+	return b.String(), nil
+}
+
+func vidLiteral(mapping config.Mapping, row map[string]interface{}, column string) (string, bool, error) {
+	value, ok := row[column]
+	if !ok || value == nil || valueString(value) == "" {
+		return "", false, nil
+	}
+	if mapping.VIDType == VIDInt {
+		vid, err := strconv.ParseInt(valueString(value), 10, 64)
+		if err != nil {
+			return "", false, xerrors.Errorf("invalid vid of %s: %w", column, err)
+		}
+		return strconv.FormatInt(vid, 10), true, nil
+	}
+	return quoteString(valueString(value)), true, nil
+}
+
+func propLiterals(props []config.PropMapping, row map[string]interface{}) (string, string, error) {
+	names := make([]string, 0, len(props))
+	values := make([]string, 0, len(props))
+	for _, prop := range props {
+		value, err := propLiteral(propType(prop), row[propColumn(prop)])
+		if err != nil {
+			return "", "", xerrors.Errorf("property %s: %w", prop.Name, err)
+		}
+		names = append(names, graph.QuoteIdent(prop.Name))
+		values = append(values, value)
+	}
+	return strings.Join(names, ", "), strings.Join(values, ", "), nil
+}
+
+// propLiteral formats value as a nGQL literal of typ.
+func propLiteral(typ string, value interface{}) (string, error) {
+	if value == nil {
+		return "NULL", nil
+	}
+	s := valueString(value)
+	if typ == PropString {
+		return quoteString(s), nil
+	}
+	if s == "" {
+		return "NULL", nil
+	}
+	switch typ {
+	case PropInt:
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatInt(i, 10), nil
+	case PropDouble:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatFloat(f, 'f', -1, 64), nil
+	case PropBool:
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatBool(v), nil
+	case PropTimestamp:
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return strconv.FormatInt(i, 10), nil
+		}
+		return fmt.Sprintf("timestamp(%s)", quoteString(s)), nil
+	case PropDate, PropTime, PropDateTime:
+		return fmt.Sprintf("%s(%s)", typ, quoteString(s)), nil
+	}
+	return "", xerrors.Errorf("unknown property type: %s", typ)
+}
+
+func valueString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case json.Number:
+		return v.String()
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	}
+	return fmt.Sprint(value)
+}
+
+var stringEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+
+func quoteString(s string) string {
+	return `"` + stringEscaper.Replace(s) + `"`
+}
+
+// importFile replays a structured data file of expert, the lines of structured
+// files count the header and the records.
+func (t *replayTask) importFile(file *FileRef, record *WriteRecord, mapping config.Mapping, transforms []Transform, counts *importCounts) (bool, error) {
+	if err := validateMapping(mapping); err != nil {
+		return false, xerrors.Errorf("expert %s mapping: %w", file.Expert, err)
+	}
+	header, rows, err := openRows(file, mapping)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	domain := header.Domain
+	if err := t.checkDomain(file, record, domain); err != nil {
+		return false, err
+	}
+	if len(domain) == 0 {
+		domain = t.conf.Server.ExpertSpaces[file.Expert]
+		if len(domain) == 0 {
+			return false, fmt.Errorf("failed to find domain. expert:%s, index:%d", file.Expert, record.Index)
+		}
+	}
+	record.Domain = domain
+	log.WithFields(logrus.Fields{
+		"id":     file.ID,
+		"domain": domain,
+		"format": mapping.Format,
+		"expert": file.Expert,
+	}).Info("expert structured file.")
+
+	line := int64(1)
+	tctx := newTransformContext(file, domain)
+	if mapping.CreateSchema && record.Line < line {
+		stmts, err := graph.ParseNGQL(mappingSchema(mapping))
+		if err != nil {
+			return false, err
+		}
+		tctx.Line = line
+		if stmts, err = applyTransforms(transforms, tctx, stmts); err != nil {
+			return false, xerrors.Errorf("failed to transform line:%d, %w", line, err)
+		}
+		err = t.applyLines(file.Expert, record, line, line, lineHash(mappingSchema(mapping)), true, func() error {
+			if err := t.writeToNebulaSql(file.Expert, line, domain, stmts, false); err != nil {
+				return err
+			}
+			for _, kind := range t.rebuildKinds(file.Expert, domain, stmts) {
+				record.markRebuild(domain, kind)
+			}
+			return nil
+		})
+		if err != nil {
+			return false, err
+		}
+	}
+
+	batch := &replayBatch{task: t, file: file, record: record}
+	for {
+		row, err := rows.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return false, xerrors.Errorf("failed to read line:%d, %w", line+1, err)
+		}
+		line++
+		if line < record.Line {
+			continue
+		}
+		sql, err := mappingStatements(mapping, row)
+		if err != nil {
+			return false, xerrors.Errorf("failed to map line:%d, %w", line, err)
+		}
+		if line == record.Line {
+			if err := checkpointHash(record, line, sql); err != nil {
+				return false, xerrors.Errorf("file %s: %w", file.ID, err)
+			}
+			continue
+		}
+		if sql == "" {
+			continue
+		}
+		stmts, err := graph.ParseNGQL(sql)
+		if err != nil {
+			return false, xerrors.Errorf("failed to parse line:%d, %w", line, err)
+		}
+		tctx.Line = line
+		if stmts, err = applyTransforms(transforms, tctx, stmts); err != nil {
+			return false, xerrors.Errorf("failed to transform line:%d, %w", line, err)
+		}
+		if len(stmts) == 0 {
+			continue
+		}
+		counts.add(stmts)
+		if err := batch.add(domain, line, stmts, lineHash(sql), true); err != nil {
+			return false, err
+		}
+	}
+	if err := batch.flush(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
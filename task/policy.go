@@ -0,0 +1,143 @@
+package task
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/EpiK-Protocol/go-epik-gateway/graph"
+	"github.com/EpiK-Protocol/go-epik-gateway/storage"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+var (
+	// ErrStatementRejected is returned in strict mode for statements outside the
+	// replay policy.
+	ErrStatementRejected = xerrors.New("statement not permitted")
+
+	spaceOwnerLk sync.Mutex
+)
+
+// SpaceOwnerKey keeps the expert owning a space not assigned by config.
+func SpaceOwnerKey(space string) []byte {
+	return []byte("task:replay:space:" + space)
+}
+
+// assignSpace returns the space expert replays into. Spaces come from
+// expert_spaces, otherwise the first space of the expert is pinned in record
+// and claimed from other experts.
+func (t *replayTask) assignSpace(expert string, record *WriteRecord, space string) (string, error) {
+	if assigned := t.conf.Server.ExpertSpaces[expert]; assigned != "" {
+		return assigned, nil
+	}
+	if record.Space != "" || space == "" {
+		return record.Space, nil
+	}
+
+	if err := t.claimSpace(expert, space); err != nil {
+		return "", err
+	}
+	record.Space = space
+	if err := t.saveRecord(expert, record); err != nil {
+		return "", err
+	}
+	log.WithFields(logrus.Fields{
+		"expert": expert,
+		"space":  space,
+	}).Info("assign expert nebula space.")
+	return space, nil
+}
+
+// claimSpace makes expert the owner of space unless another expert owns it.
+func (t *replayTask) claimSpace(expert string, space string) error {
+	spaceOwnerLk.Lock()
+	defer spaceOwnerLk.Unlock()
+	owner, err := t.storage.Get(SpaceOwnerKey(space))
+	if err != nil && err != storage.ErrKeyNotFound {
+		return err
+	}
+	if err == nil && string(owner) != expert {
+		return xerrors.Errorf("space %s is owned by expert %s", space, owner)
+	}
+	return t.storage.Put(SpaceOwnerKey(space), []byte(expert))
+}
+
+// checkDomain fails files declaring a domain other than the expert space.
+func (t *replayTask) checkDomain(file *FileRef, record *WriteRecord, domain string) error {
+	space, err := t.assignSpace(file.Expert, record, domain)
+	if err != nil {
+		return xerrors.Errorf("file %s: %w", file.ID, err)
+	}
+	if domain != "" && domain != space {
+		return xerrors.Errorf("file %s: domain %s is not the expert space %s", file.ID, domain, space)
+	}
+	return nil
+}
+
+// checkStatement permits creating the schema of and writing data into the
+// assigned space only.
+func checkStatement(space string, stmt *graph.Statement) error {
+	if stmt.HasPipe() {
+		return fmt.Errorf("%w: pipe in %s", ErrStatementRejected, stmt.Verb)
+	}
+	switch stmt.Kind {
+	case graph.StatementCreateSpace, graph.StatementUse:
+		if stmt.Space != space {
+			return fmt.Errorf("%w: space %s is not assigned", ErrStatementRejected, stmt.Space)
+		}
+	case graph.StatementCreateTag, graph.StatementCreateEdge, graph.StatementCreateTagIndex, graph.StatementCreateEdgeIndex,
+		graph.StatementInsertVertex, graph.StatementInsertEdge, graph.StatementUpsertVertex, graph.StatementUpsertEdge:
+	default:
+		return fmt.Errorf("%w: %s", ErrStatementRejected, stmt.Verb)
+	}
+	return nil
+}
+
+// allowStatements drops the statements of a line outside the replay policy. In
+// strict mode the first one fails the expert until it is force advanced.
+func (t *replayTask) allowStatements(file *FileRef, record *WriteRecord, line int64, stmts []*graph.Statement) ([]*graph.Statement, error) {
+	space, err := t.assignSpace(file.Expert, record, createdSpace(stmts))
+	if err != nil {
+		return nil, err
+	}
+
+	// lines read again after a failed write are not counted twice.
+	count := record.Index > record.RejectedIndex || (record.Index == record.RejectedIndex && line > record.RejectedLine)
+	allowed := stmts[:0]
+	for _, stmt := range stmts {
+		err := checkStatement(space, stmt)
+		if err == nil {
+			allowed = append(allowed, stmt)
+			continue
+		}
+		if count {
+			record.Rejected++
+			record.RejectedIndex, record.RejectedLine = record.Index, line
+		}
+		log.WithFields(logrus.Fields{
+			"id":       file.ID,
+			"expert":   file.Expert,
+			"line":     line,
+			"space":    space,
+			"rejected": record.Rejected,
+			"error":    err,
+		}).Warn("reject expert nebula statement.")
+		if t.conf.Replay.Strict {
+			return nil, t.failRejected(file, record, line, err)
+		}
+	}
+	return allowed, nil
+}
+
+// failRejected stops expert on a statement rejected in strict mode.
+func (t *replayTask) failRejected(file *FileRef, record *WriteRecord, line int64, rejected error) error {
+	reason := fmt.Sprintf("file %s line %d: %v", file.ID, line, rejected)
+	if err := audit(t.storage, &AuditEntry{Expert: file.Expert, Action: AuditReject, From: record.Index, To: record.Index, Reason: reason}); err != nil {
+		return err
+	}
+	record.Failed = reason
+	if err := t.saveRecord(file.Expert, record); err != nil {
+		return err
+	}
+	return xerrors.Errorf("expert %s %s: %w", file.Expert, reason, ErrExpertFailed)
+}
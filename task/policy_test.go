@@ -0,0 +1,51 @@
+package task
+
+import (
+	"testing"
+
+	"github.com/EpiK-Protocol/go-epik-gateway/app/config"
+	"golang.org/x/xerrors"
+)
+
+func TestAllowStatements(t *testing.T) {
+	conf := config.Config{}
+	conf.Server.ExpertSpaces = map[string]string{"e": "sp"}
+	task, _ := newTestReplay(t, conf)
+	file := &FileRef{ID: "f", Expert: "e", Index: 1}
+	record, err := task.expertRecord("e")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sql := `USE sp;DROP SPACE other;INSERT VERTEX t(v) VALUES "a":("A");USE other`
+	for i := 0; i < 2; i++ {
+		// the line is read again as after a failed write.
+		allowed, err := task.allowStatements(file, record, 2, parseNGQL(t, sql))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(allowed) != 2 || record.Rejected != 2 {
+			t.Fatalf("%d allowed, %d rejected", len(allowed), record.Rejected)
+		}
+	}
+	if _, err := task.allowStatements(file, record, 3, parseNGQL(t, sql)); err != nil || record.Rejected != 4 {
+		t.Fatalf("%d rejected, %v", record.Rejected, err)
+	}
+
+	task.conf.Replay.Strict = true
+	_, err = task.allowStatements(file, record, 4, parseNGQL(t, sql))
+	if !xerrors.Is(err, ErrExpertFailed) || record.Failed == "" {
+		t.Fatalf("strict: %v", err)
+	}
+	if record.Rejected != 5 {
+		t.Errorf("%d rejected", record.Rejected)
+	}
+	if err := task.replayFile(file); !xerrors.Is(err, ErrExpertFailed) {
+		t.Errorf("failed expert replayed: %v", err)
+	}
+	if _, err := task.Advance("e", 1, "checked"); err != nil {
+		t.Fatal(err)
+	}
+	if record, _ := task.expertRecord("e"); record.Failed != "" {
+		t.Errorf("still failed: %s", record.Failed)
+	}
+}
@@ -0,0 +1,248 @@
+package task
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/EpiK-Protocol/go-epik-gateway/utils"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// RebuildDrop drops the expert space before re-import.
+	RebuildDrop = "drop"
+	// RebuildKeep re-imports into the existing space.
+	RebuildKeep = "keep"
+	// RebuildShadow re-imports into a new version of the space, which serves
+	// the space once the expert catches up.
+	RebuildShadow = "shadow"
+
+	AuditRebuild = "rebuild"
+
+	rebuildTokenTTL = 10 * time.Minute
+)
+
+var (
+	// ErrRebuildToken is returned when a rebuild is confirmed by a token which
+	// is unknown, expired or issued for another state of the expert.
+	ErrRebuildToken = xerrors.New("invalid rebuild confirmation token")
+
+	rebuildTokensLk sync.Mutex
+	rebuildTokens   = map[string]time.Time{}
+)
+
+// RebuildPlan describes a rebuild of an expert, the token of a dry run
+// confirms the same plan.
+type RebuildPlan struct {
+	Expert string `json:"expert"`
+	Space  string `json:"space"`
+	Mode   string `json:"mode"`
+	// nebula space imported into by a shadow rebuild.
+	Shadow string `json:"shadow,omitempty"`
+	// replay progress dropped by the rebuild.
+	Index int64          `json:"index"`
+	Line  int64          `json:"line"`
+	Files []*RebuildFile `json:"files"`
+
+	DryRun bool   `json:"dry_run"`
+	Token  string `json:"token,omitempty"`
+}
+
+type RebuildFile struct {
+	Index int64  `json:"index"`
+	ID    string `json:"id"`
+	// local copy is missing and downloaded again.
+	Download bool `json:"download,omitempty"`
+}
+
+func (p *RebuildPlan) token() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s|%s|%s|%s|%d|%d", p.Expert, p.Space, p.Mode, p.Shadow, p.Index, p.Line)
+	for _, file := range p.Files {
+		fmt.Fprintf(h, "|%d:%s", file.Index, file.ID)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+func issueRebuildToken(token string) {
+	rebuildTokensLk.Lock()
+	defer rebuildTokensLk.Unlock()
+	now := time.Now()
+	for t, expiry := range rebuildTokens {
+		if now.After(expiry) {
+			delete(rebuildTokens, t)
+		}
+	}
+	rebuildTokens[token] = now.Add(rebuildTokenTTL)
+}
+
+func useRebuildToken(token string) bool {
+	rebuildTokensLk.Lock()
+	defer rebuildTokensLk.Unlock()
+	expiry, ok := rebuildTokens[token]
+	delete(rebuildTokens, token)
+	return ok && time.Now().Before(expiry)
+}
+
+// expertSpace returns the space expert replays into.
+func (t *replayTask) expertSpace(expert string, record *WriteRecord) string {
+	if space := t.conf.Server.ExpertSpaces[expert]; space != "" {
+		return space
+	}
+	if record.Space != "" {
+		return record.Space
+	}
+	return record.Domain
+}
+
+// Rebuild re-imports all files of expert from the first index. A dry run
+// returns the plan with a token, which confirms the rebuild of the same plan.
+func (t *replayTask) Rebuild(expert string, mode string, dryRun bool, token string) (*RebuildPlan, error) {
+	switch mode {
+	case "":
+		mode = RebuildDrop
+	case RebuildDrop, RebuildKeep, RebuildShadow:
+	case "rename":
+		return nil, xerrors.New("nebula can't rename a space, use drop, keep or shadow")
+	default:
+		return nil, xerrors.Errorf("unknown rebuild mode: %s", mode)
+	}
+	if _, err := t.loadRecord(expert); err != nil {
+		return nil, err
+	}
+	lk := t.expertLock(expert)
+	lk.Lock()
+	defer lk.Unlock()
+
+	record, err := t.expertRecord(expert)
+	if err != nil {
+		return nil, err
+	}
+	plan := &RebuildPlan{
+		Expert: expert,
+		Space:  t.expertSpace(expert, record),
+		Mode:   mode,
+		Index:  record.Index,
+		Line:   record.Line,
+		Files:  []*RebuildFile{},
+		DryRun: dryRun,
+	}
+	if mode == RebuildShadow {
+		if plan.Space == "" {
+			return nil, xerrors.Errorf("expert %s has no space to shadow", expert)
+		}
+		versions, err := loadSpaceVersions(t.storage, plan.Space)
+		if err != nil {
+			return nil, err
+		}
+		plan.Shadow = shadowSpace(versions)
+	}
+	files := []*FileRef{}
+	for index, id := range record.History {
+		file, err := loadFile(t.storage, id)
+		if err != nil {
+			return nil, xerrors.Errorf("file %s of index %d: %w", id, index, err)
+		}
+		exist, err := utils.Exists(file.LocalPath)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+		plan.Files = append(plan.Files, &RebuildFile{Index: index, ID: id, Download: !exist})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Index < files[j].Index
+	})
+	sort.Slice(plan.Files, func(i, j int) bool {
+		return plan.Files[i].Index < plan.Files[j].Index
+	})
+
+	if dryRun {
+		plan.Token = plan.token()
+		issueRebuildToken(plan.Token)
+		return plan, nil
+	}
+	if token == "" || token != plan.token() || !useRebuildToken(token) {
+		return nil, ErrRebuildToken
+	}
+
+	if err := t.abandonShadow(expert, record); err != nil {
+		return nil, err
+	}
+	switch {
+	case mode == RebuildDrop && plan.Space != "":
+		if err := t.dropSpace(expert, plan.Space); err != nil {
+			return nil, err
+		}
+	case mode == RebuildShadow:
+		if err := t.shadow(expert, record, plan.Space); err != nil {
+			return nil, err
+		}
+	}
+	if err := t.clearJournals(expert); err != nil {
+		return nil, err
+	}
+	if err := t.clearReconcile(expert); err != nil {
+		return nil, err
+	}
+	reason := fmt.Sprintf("%s space %s", mode, plan.Space)
+	if err := audit(t.storage, &AuditEntry{Expert: expert, Action: AuditRebuild, From: record.Index, To: 1, Reason: reason}); err != nil {
+		return nil, err
+	}
+	*record = WriteRecord{
+		Index:    1,
+		History:  record.History,
+		Space:    record.Space,
+		Shadow:   record.Shadow,
+		ShadowOf: record.ShadowOf,
+	}
+	if err := t.saveRecord(expert, record); err != nil {
+		return nil, err
+	}
+	if err := t.requeueFiles(files); err != nil {
+		return nil, err
+	}
+
+	log.WithFields(logrus.Fields{
+		"expert": expert,
+		"space":  plan.Space,
+		"mode":   mode,
+		"files":  len(files),
+	}).Warn("rebuild expert.")
+	return plan, nil
+}
+
+// requeueFiles puts files back to the replay list, files without local copy
+// are downloaded again.
+func (t *replayTask) requeueFiles(files []*FileRef) error {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	if t.files == nil {
+		files, err := loadDatas(t.storage, ReplayFilesKey)
+		if err != nil {
+			return err
+		}
+		t.files = files
+	}
+	for _, file := range files {
+		exist, err := utils.Exists(file.LocalPath)
+		if err != nil {
+			return err
+		}
+		if !exist {
+			file.Status = FileStatusNew
+		} else if file.Status > FileStatusDownloaded {
+			file.Status = FileStatusDownloaded
+		}
+		if err := saveFile(t.storage, file); err != nil {
+			return err
+		}
+		t.files[file.ID] = file
+	}
+	return saveDatas(t.storage, ReplayFilesKey, t.files, false)
+}
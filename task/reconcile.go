@@ -0,0 +1,271 @@
+package task
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/EpiK-Protocol/go-epik-gateway/graph"
+	"github.com/EpiK-Protocol/go-epik-gateway/storage"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+const (
+	ReconcileMatched    = "matched"
+	ReconcileMismatched = "mismatched"
+	// the stats of the space could not be read.
+	ReconcileError = "error"
+
+	AuditReimport = "reimport"
+)
+
+// importCounts are the distinct vertices by tag and edges by edge type
+// written by a file. Lines replayed before a restart are not counted, so
+// the counts are lower bounds.
+type importCounts struct {
+	tags  map[string]map[string]bool
+	edges map[string]map[string]bool
+	// non-idempotent statements of the file, checkpointed lines included.
+	upserts int64
+}
+
+func newImportCounts() *importCounts {
+	return &importCounts{
+		tags:  map[string]map[string]bool{},
+		edges: map[string]map[string]bool{},
+	}
+}
+
+func countKey(counts map[string]map[string]bool, name string, key string) {
+	if counts[name] == nil {
+		counts[name] = map[string]bool{}
+	}
+	counts[name][key] = true
+}
+
+func (c *importCounts) add(stmts []*graph.Statement) {
+	c.addUpserts(stmts)
+	for _, stmt := range stmts {
+		switch stmt.Kind {
+		case graph.StatementInsertVertex, graph.StatementUpsertVertex:
+			for _, row := range stmt.Rows {
+				for _, tag := range stmt.Tags {
+					countKey(c.tags, tag, fmt.Sprint(graph.Literal(row.ID)))
+				}
+			}
+		case graph.StatementInsertEdge, graph.StatementUpsertEdge:
+			for _, row := range stmt.Rows {
+				key := fmt.Sprintf("%v->%v@%d", graph.Literal(row.Src), graph.Literal(row.Dst), row.Rank)
+				countKey(c.edges, stmt.Name, key)
+			}
+		}
+	}
+}
+
+func (c *importCounts) addUpserts(stmts []*graph.Statement) {
+	for _, stmt := range stmts {
+		if !graph.Idempotent([]*graph.Statement{stmt}) {
+			c.upserts++
+		}
+	}
+}
+
+func sizes(counts map[string]map[string]bool) map[string]int64 {
+	result := make(map[string]int64, len(counts))
+	for name, keys := range counts {
+		result[name] = int64(len(keys))
+	}
+	return result
+}
+
+// ReconcileReport compares the counts written by a file with the stats of
+// its space once the file is imported.
+type ReconcileReport struct {
+	Expert string `json:"expert"`
+	Index  int64  `json:"index"`
+	ID     string `json:"id"`
+	Space  string `json:"space"`
+	Time   int64  `json:"time"`
+	Status string `json:"status"`
+
+	// distinct vertices by tag and edges by edge type of the file.
+	ExpectedTags  map[string]int64 `json:"expected_tags"`
+	ExpectedEdges map[string]int64 `json:"expected_edges"`
+	Live          *graph.Stats     `json:"live,omitempty"`
+	Mismatches    []string         `json:"mismatches,omitempty"`
+	Error         string           `json:"error,omitempty"`
+	// the file is imported again.
+	Reimport bool `json:"reimport,omitempty"`
+	// imports of the file done for mismatches before this report.
+	Attempts int `json:"attempts,omitempty"`
+	// upserts of the file, a file with any is not imported again as they
+	// would be applied twice.
+	Upserts int64 `json:"upserts,omitempty"`
+}
+
+// ExpertReconcile is the latest reconcile report of each file of an expert.
+type ExpertReconcile struct {
+	Expert     string             `json:"expert"`
+	Files      int                `json:"files"`
+	Mismatched []int64            `json:"mismatched"`
+	Reports    []*ReconcileReport `json:"reports"`
+}
+
+func ReconcilePrefix(expert string) []byte {
+	return []byte("task:replay:reconcile:" + expert + ":")
+}
+
+func ReconcileKey(expert string, index int64) []byte {
+	return []byte(fmt.Sprintf("%s%020d", ReconcilePrefix(expert), index))
+}
+
+// reconcile counts the space of an imported file after a stats job, it
+// returns whether the file needs to be imported again. Failing to read the
+// stats is reported without stopping the replay.
+func (t *replayTask) reconcile(file *FileRef, record *WriteRecord, counts *importCounts) (bool, error) {
+	if !t.conf.Replay.Reconcile {
+		return false, nil
+	}
+	report := &ReconcileReport{
+		Expert:        file.Expert,
+		Index:         record.Index,
+		ID:            file.ID,
+		Space:         record.Domain,
+		Time:          time.Now().Unix(),
+		ExpectedTags:  sizes(counts.tags),
+		ExpectedEdges: sizes(counts.edges),
+		Attempts:      record.Reimports[record.Index],
+		Upserts:       counts.upserts,
+	}
+	live, err := t.spaceStats(file.Expert, record.Domain)
+	if err != nil {
+		report.Status = ReconcileError
+		report.Error = err.Error()
+		log.WithFields(logrus.Fields{
+			"expert": file.Expert,
+			"index":  record.Index,
+			"space":  record.Domain,
+			"error":  err,
+		}).Error("failed to reconcile imported file.")
+		return false, t.saveReconcile(report)
+	}
+	report.Live = live
+
+	for tag, expected := range report.ExpectedTags {
+		if count := live.Tags[tag]; count < expected {
+			report.Mismatches = append(report.Mismatches, fmt.Sprintf("tag %s: %d of %d vertices", tag, count, expected))
+		}
+	}
+	for edge, expected := range report.ExpectedEdges {
+		if count := live.Edges[edge]; count < expected {
+			report.Mismatches = append(report.Mismatches, fmt.Sprintf("edge %s: %d of %d edges", edge, count, expected))
+		}
+	}
+	sort.Strings(report.Mismatches)
+	if len(report.Mismatches) == 0 {
+		report.Status = ReconcileMatched
+		delete(record.Reimports, record.Index)
+		return false, t.saveReconcile(report)
+	}
+
+	report.Status = ReconcileMismatched
+	report.Reimport = report.Attempts < t.conf.Replay.ReimportAttempts && report.Upserts == 0
+	log.WithFields(logrus.Fields{
+		"expert":     file.Expert,
+		"index":      record.Index,
+		"space":      record.Domain,
+		"mismatches": report.Mismatches,
+		"upserts":    report.Upserts,
+		"reimport":   report.Reimport,
+	}).Warn("imported file mismatches nebula stats.")
+	if err := t.saveReconcile(report); err != nil {
+		return false, err
+	}
+	if !report.Reimport {
+		delete(record.Reimports, record.Index)
+		return false, nil
+	}
+	if record.Reimports == nil {
+		record.Reimports = map[int64]int{}
+	}
+	record.Reimports[record.Index]++
+	err = audit(t.storage, &AuditEntry{
+		Expert: file.Expert,
+		Action: AuditReimport,
+		From:   record.Index,
+		To:     record.Index,
+		Reason: strings.Join(report.Mismatches, "; "),
+	})
+	return true, err
+}
+
+// spaceStats runs a stats job on the nebula space serving space.
+func (t *replayTask) spaceStats(expert string, space string) (*graph.Stats, error) {
+	nebulaSpace := t.nebulaSpace(expert, space)
+	job, err := t.store.SubmitStats(nebulaSpace)
+	if err != nil {
+		return nil, err
+	}
+	if job > 0 {
+		status, err := t.awaitJob(expert, space, job, "stats")
+		if err != nil {
+			return nil, err
+		}
+		if status != JobStatusFinished {
+			return nil, xerrors.Errorf("stats job %d of space %s %s", job, space, strings.ToLower(status))
+		}
+	}
+	return t.store.Stats(nebulaSpace)
+}
+
+func (t *replayTask) saveReconcile(report *ReconcileReport) error {
+	bytes, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	return t.storage.Put(ReconcileKey(report.Expert, report.Index), bytes)
+}
+
+func (t *replayTask) Reconciliation(expert string) (*ExpertReconcile, error) {
+	if _, err := t.storage.Get(RecordKey(expert)); err != nil {
+		return nil, err
+	}
+	result := &ExpertReconcile{Expert: expert, Mismatched: []int64{}, Reports: []*ReconcileReport{}}
+	err := t.storage.Iterate(ReconcilePrefix(expert), func(key []byte, value []byte) error {
+		report := &ReconcileReport{}
+		if err := json.Unmarshal(value, report); err != nil {
+			return err
+		}
+		result.Reports = append(result.Reports, report)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(result.Reports, func(i, j int) bool {
+		return result.Reports[i].Index < result.Reports[j].Index
+	})
+	for _, report := range result.Reports {
+		if report.Status == ReconcileMismatched {
+			result.Mismatched = append(result.Mismatched, report.Index)
+		}
+	}
+	result.Files = len(result.Reports)
+	return result, nil
+}
+
+// clearReconcile removes the reconcile reports of expert.
+func (t *replayTask) clearReconcile(expert string) error {
+	entries := []storage.Entry{}
+	err := t.storage.Iterate(ReconcilePrefix(expert), func(key []byte, value []byte) error {
+		entries = append(entries, storage.Entry{Key: key})
+		return nil
+	})
+	if err != nil || len(entries) == 0 {
+		return err
+	}
+	return t.storage.Write(entries...)
+}
@@ -0,0 +1,59 @@
+package task
+
+import (
+	"testing"
+
+	"github.com/EpiK-Protocol/go-epik-gateway/app/config"
+)
+
+func TestReconcile(t *testing.T) {
+	conf := config.Config{}
+	conf.Replay.Reconcile = true
+	conf.Replay.ReimportAttempts = 1
+	task, store := newTestReplay(t, conf)
+	schema := "CREATE SPACE sp(vid_type=FIXED_STRING(8));USE sp;CREATE TAG t(v string);CREATE EDGE e(w int)"
+	if err := store.CreateSchema("sp", parseNGQL(t, schema), false); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Upsert("sp", parseNGQL(t, `INSERT VERTEX t(v) VALUES "a":("A");INSERT EDGE e(w) VALUES "a"->"a":(1)`)); err != nil {
+		t.Fatal(err)
+	}
+	file := &FileRef{ID: "f", Expert: "ex", Index: 1}
+	record, err := task.expertRecord("ex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	record.Domain = "sp"
+
+	matched := newImportCounts()
+	matched.add(parseNGQL(t, `INSERT VERTEX t(v) VALUES "a":("A"), "a":("B");INSERT EDGE e(w) VALUES "a"->"a":(1)`))
+	if reimport, err := task.reconcile(file, record, matched); err != nil || reimport {
+		t.Fatalf("matched file reimported %v, %v", reimport, err)
+	}
+
+	missing := newImportCounts()
+	missing.add(parseNGQL(t, `INSERT VERTEX t(v) VALUES "a":("A"), "b":("B")`))
+	if reimport, err := task.reconcile(file, record, missing); err != nil || !reimport {
+		t.Fatalf("mismatched file not reimported %v, %v", reimport, err)
+	}
+	if reimport, err := task.reconcile(file, record, missing); err != nil || reimport {
+		t.Fatalf("reimported beyond attempts %v, %v", reimport, err)
+	}
+
+	upserts := newImportCounts()
+	upserts.add(parseNGQL(t, `INSERT VERTEX t(v) VALUES "b":("B");UPSERT VERTEX ON t "a" SET v = v + "A"`))
+	if reimport, err := task.reconcile(file, record, upserts); err != nil || reimport {
+		t.Fatalf("file with upserts reimported %v, %v", reimport, err)
+	}
+	if err := task.saveRecord("ex", record); err != nil {
+		t.Fatal(err)
+	}
+	result, err := task.Reconciliation("ex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := result.Reports[0]
+	if report.Status != ReconcileMismatched || report.Upserts != 1 || report.Reimport {
+		t.Errorf("report %+v", report)
+	}
+}
@@ -0,0 +1,154 @@
+package task
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/EpiK-Protocol/go-epik-gateway/graph"
+	"github.com/EpiK-Protocol/go-epik-gateway/storage"
+	"github.com/sirupsen/logrus"
+)
+
+var schemaLk sync.Mutex
+
+// SpaceSchema is the schema the replay created in a space, each change is a
+// new version.
+type SpaceSchema struct {
+	Space   string `json:"space"`
+	Expert  string `json:"expert"`
+	Version int64  `json:"version"`
+	Updated int64  `json:"updated"`
+
+	*graph.Schema
+}
+
+// SchemaChange is a statement which changed the schema of a space.
+type SchemaChange struct {
+	Version   int64  `json:"version"`
+	Time      int64  `json:"time"`
+	Expert    string `json:"expert"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Statement string `json:"statement"`
+}
+
+func SchemaKey(space string) []byte {
+	return []byte("task:replay:schema:" + space)
+}
+
+func SchemaHistoryKey(space string, version int64) []byte {
+	return []byte(fmt.Sprintf("task:replay:schema-history:%s:%020d", space, version))
+}
+
+func loadSpaceSchema(st storage.Storage, space string) (*SpaceSchema, error) {
+	bytes, err := st.Get(SchemaKey(space))
+	if err != nil {
+		return nil, err
+	}
+	schema := &SpaceSchema{}
+	if err := json.Unmarshal(bytes, schema); err != nil {
+		return nil, err
+	}
+	if schema.Schema == nil {
+		schema.Schema = graph.NewSchema()
+	}
+	return schema, nil
+}
+
+// registerSchema records the schemas created by stmts in the registry of
+// space, statements creating existing ones are skipped.
+func (t *replayTask) registerSchema(expert string, space string, stmts []*graph.Statement) error {
+	schemaLk.Lock()
+	defer schemaLk.Unlock()
+	schema, err := loadSpaceSchema(t.storage, space)
+	if err == storage.ErrKeyNotFound {
+		schema = &SpaceSchema{Space: space, Schema: graph.NewSchema()}
+	} else if err != nil {
+		return err
+	}
+
+	now := time.Now().Unix()
+	entries := []storage.Entry{}
+	for _, stmt := range stmts {
+		changed := schema.Apply(stmt)
+		if stmt.Kind == graph.StatementCreateSpace {
+			changed = schema.Version == 0
+		}
+		if !changed {
+			continue
+		}
+		schema.Version++
+		change := &SchemaChange{
+			Version:   schema.Version,
+			Time:      now,
+			Expert:    expert,
+			Kind:      string(stmt.Kind),
+			Name:      stmt.Name,
+			Statement: stmt.String(),
+		}
+		if stmt.Index != "" {
+			change.Name = stmt.Index
+		}
+		bytes, err := json.Marshal(change)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, storage.Entry{Key: SchemaHistoryKey(space, schema.Version), Value: bytes})
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	schema.Expert = expert
+	schema.Updated = now
+	bytes, err := json.Marshal(schema)
+	if err != nil {
+		return err
+	}
+	if err := t.storage.Write(append(entries, storage.Entry{Key: SchemaKey(space), Value: bytes})...); err != nil {
+		return err
+	}
+	log.WithFields(logrus.Fields{
+		"expert":  expert,
+		"space":   space,
+		"version": schema.Version,
+	}).Info("register space schema.")
+	return nil
+}
+
+func (t *replayTask) Schema(space string) (*SpaceSchema, []*SchemaChange, error) {
+	schema, err := loadSpaceSchema(t.storage, space)
+	if err != nil {
+		return nil, nil, err
+	}
+	history := []*SchemaChange{}
+	err = t.storage.Iterate([]byte(fmt.Sprintf("task:replay:schema-history:%s:", space)), func(key []byte, value []byte) error {
+		change := &SchemaChange{}
+		if err := json.Unmarshal(value, change); err != nil {
+			return err
+		}
+		history = append(history, change)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Slice(history, func(i, j int) bool {
+		return history[i].Version < history[j].Version
+	})
+	return schema, history, nil
+}
+
+func (t *replayTask) SchemaDrift(space string) ([]*graph.SchemaDrift, error) {
+	schema, err := loadSpaceSchema(t.storage, space)
+	if err != nil {
+		return nil, err
+	}
+	live, err := t.store.Schema(t.ResolveSpace(space))
+	if err != nil {
+		return nil, err
+	}
+	return graph.DiffSchema(schema.Schema, live), nil
+}
@@ -5,24 +5,20 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"os"
-	"strings"
+	"sort"
 	"sync"
-	"time"
 
 	"github.com/EpiK-Protocol/go-epik-gateway/app/config"
+	"github.com/EpiK-Protocol/go-epik-gateway/graph"
 	"github.com/EpiK-Protocol/go-epik-gateway/storage"
+	"github.com/EpiK-Protocol/go-epik-gateway/utils"
 	"github.com/asaskevich/EventBus"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/xerrors"
-
-	nebula "github.com/vesoft-inc/nebula-go/v2"
 )
 
 var (
 	ReplayFilesKey = []byte("task:replay")
-	nebLog         = nebula.DefaultLogger{}
-	ReservedFields = []string{"GO", "AS", "TO", "OR", "AND", "XOR", "USE", "SET", "FROM", "WHERE", "MATCH", "INSERT", "YIELD", "RETURN", "DESCRIBE", "DESC", "VERTEX", "VERTICES", "EDGE", "EDGES", "UPDATE", "UPSERT", "WHEN", "DELETE", "FIND", "LOOKUP", "ALTER", "STEPS", "STEP", "OVER", "UPTO", "REVERSELY", "INDEX", "INDEXES", "REBUILD", "BOOL", "INT8", "INT16", "INT32", "INT64", "INT", "FLOAT", "DOUBLE", "STRING", "FIXED_STRING", "TIMESTAMP", "DATE", "TIME", "DATETIME", "TAG", "TAGS", "UNION", "INTERSECT", "MINUS", "NO", "OVERWRITE", "SHOW", "ADD", "CREATE", "DROP", "REMOVE", "IF", "NOT", "EXISTS", "WITH", "CHANGE", "GRANT", "REVOKE", "ON", "BY", "IN", "NOT_IN", "DOWNLOAD", "GET", "OF", "ORDER", "INGEST", "COMPACT", "FLUSH", "SUBMIT", "ASC", "ASCENDING", "DESCENDING", "DISTINCT", "FETCH", "PROP", "BALANCE", "STOP", "LIMIT", "OFFSET", "IS", "NULL", "RECOVER", "EXPLAIN", "PROFILE", "FORMAT", "CASE"}
 )
 
 type WriteRecord struct {
@@ -30,6 +26,26 @@ type WriteRecord struct {
 	Index   int64
 	Line    int64
 	History map[int64]string
+	// index rebuilds to run once the current file is imported.
+	Rebuilds []*IndexRebuild `json:",omitempty"`
+	// space the expert is pinned to, unless assigned by expert_spaces.
+	Space string `json:",omitempty"`
+	// count of statements rejected by the replay policy, up to the file
+	// index and line last counted.
+	Rejected      int64 `json:",omitempty"`
+	RejectedIndex int64 `json:",omitempty"`
+	RejectedLine  int64 `json:",omitempty"`
+	// statement hash of the checkpointed line.
+	Hash string `json:",omitempty"`
+	// unix time the current index is found missing while later ones exist.
+	GapSince int64 `json:",omitempty"`
+	// reason the expert is stopped until force advanced.
+	Failed string `json:",omitempty"`
+	// nebula space a shadow rebuild of ShadowOf replays into.
+	Shadow   string `json:",omitempty"`
+	ShadowOf string `json:",omitempty"`
+	// imports by file index repeated for reconcile mismatches.
+	Reimports map[int64]int `json:",omitempty"`
 }
 
 type replayTask struct {
@@ -41,20 +57,29 @@ type replayTask struct {
 	files   map[string]*FileRef
 	records map[string]*WriteRecord
 
-	nebulasPool *nebula.ConnectionPool
+	recordLk  sync.Mutex
+	expertLks map[string]*sync.Mutex
+
+	store graph.GraphStore
+	// pauses the replay while nebula is unreachable.
+	breaker *graphBreaker
 
 	quitChs      map[string]chan bool
 	isProcessing bool
 }
 
-func newReplayTask(conf config.Config, st storage.Storage, bus EventBus.Bus) (*replayTask, error) {
+func newReplayTask(conf config.Config, st storage.Storage, bus EventBus.Bus, store graph.GraphStore) (*replayTask, error) {
 
+	throttled := newThrottledStore(conf.Replay, store)
 	task := &replayTask{
 		conf:         conf,
 		storage:      st,
 		bus:          bus,
+		store:        throttled,
+		breaker:      throttled.breaker,
 		files:        nil,
 		records:      map[string]*WriteRecord{},
+		expertLks:    map[string]*sync.Mutex{},
 		quitChs:      make(map[string]chan bool),
 		isProcessing: false,
 	}
@@ -86,11 +111,6 @@ func (t *replayTask) onProcessing() bool {
 	return t.isProcessing
 }
 
-func (t *replayTask) deleteExpert(expert string) {
-	saveDatas(t.storage, ReplayFilesKey, t.files, false)
-	t.deleteRecord(expert)
-}
-
 func (t *replayTask) process(ctx context.Context) error {
 	if t.onProcessing() {
 		return nil
@@ -113,6 +133,12 @@ func (t *replayTask) process(ctx context.Context) error {
 		}).Info("load replay data.")
 	}
 
+	if pause := t.breaker.paused(); pause > 0 {
+		log.WithFields(logrus.Fields{
+			"pause": pause,
+		}).Debug("replay paused, nebula unreachable.")
+		return nil
+	}
 	if err := t.handleReplaies(ctx); err != nil {
 		return err
 	}
@@ -124,13 +150,79 @@ func (t *replayTask) stop() {
 	for _, ch := range t.quitChs {
 		ch <- true
 	}
-	if t.nebulasPool != nil {
-		t.nebulasPool.Close()
-	}
 }
 
+// handleReplaies replays experts in parallel, files of one expert are
+// replayed in index order.
 func (t *replayTask) handleReplaies(ctx context.Context) error {
+	t.lk.Lock()
+	experts := make(map[string][]*FileRef)
 	for _, file := range t.files {
+		experts[file.Expert] = append(experts[file.Expert], file)
+	}
+	t.lk.Unlock()
+
+	var (
+		wg      sync.WaitGroup
+		errLk   sync.Mutex
+		lastErr error
+	)
+	workers := make(chan struct{}, t.replayWorkers())
+	for expert, files := range experts {
+		if ctx.Err() != nil {
+			break
+		}
+		workers <- struct{}{}
+		wg.Add(1)
+		go func(expert string, files []*FileRef) {
+			defer func() {
+				<-workers
+				wg.Done()
+			}()
+			if err := t.replayExpert(ctx, files); err != nil {
+				if graph.IsUnavailable(err) {
+					t.breaker.open(err)
+				}
+				log.WithFields(logrus.Fields{
+					"expert": expert,
+					"error":  err,
+				}).Error("failed to replay expert.")
+				errLk.Lock()
+				lastErr = err
+				errLk.Unlock()
+			}
+		}(expert, files)
+	}
+	wg.Wait()
+	return lastErr
+}
+
+func (t *replayTask) replayWorkers() int {
+	if t.conf.Replay.Workers > 0 {
+		return t.conf.Replay.Workers
+	}
+	return 1
+}
+
+func (t *replayTask) replayExpert(ctx context.Context, files []*FileRef) error {
+	if len(files) == 0 {
+		return nil
+	}
+	lk := t.expertLock(files[0].Expert)
+	lk.Lock()
+	defer lk.Unlock()
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Index < files[j].Index
+	})
+	files, err := t.pruneFiles(files)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		log.WithFields(logrus.Fields{
 			"id":    file.ID,
 			"index": file.Index,
@@ -151,31 +243,54 @@ func (t *replayTask) handleReplaies(ctx context.Context) error {
 	return nil
 }
 
+// expertRecord returns the cached replay record of expert, a new one is
+// created for experts never replayed.
+func (t *replayTask) expertRecord(expert string) (*WriteRecord, error) {
+	t.recordLk.Lock()
+	defer t.recordLk.Unlock()
+	if record, ok := t.records[expert]; ok {
+		return record, nil
+	}
+	record, err := t.loadRecord(expert)
+	log.WithFields(logrus.Fields{
+		"expert": expert,
+		"record": record,
+	}).Info("load record.")
+	if err == storage.ErrKeyNotFound {
+		record = &WriteRecord{
+			Index:   1,
+			Line:    0,
+			History: map[int64]string{},
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	t.records[expert] = record
+	return record, nil
+}
+
+// expertLock serializes the replay and the manual changes of expert.
+func (t *replayTask) expertLock(expert string) *sync.Mutex {
+	t.recordLk.Lock()
+	defer t.recordLk.Unlock()
+	lk, ok := t.expertLks[expert]
+	if !ok {
+		lk = &sync.Mutex{}
+		t.expertLks[expert] = lk
+	}
+	return lk
+}
+
 func (t *replayTask) replayFile(file *FileRef) error {
 	// log.Debug("parse file.")
-	record, ok := t.records[file.Expert]
-	if !ok {
-		index := file.Index
-		data, err := t.loadRecord(file.Expert)
-		log.WithFields(logrus.Fields{
-			"fileRef": file,
-			"record":  data,
-		}).Info("load record.")
-		if err == storage.ErrKeyNotFound {
-			data = &WriteRecord{
-				Index:   1,
-				Line:    0,
-				History: map[int64]string{},
-			}
-		} else if err != nil {
-			return err
-		}
-		data.History[index] = file.ID
-		t.records[file.Expert] = data
-		record = data
-	} else {
-		record.History[file.Index] = file.ID
+	record, err := t.expertRecord(file.Expert)
+	if err != nil {
+		return err
+	}
+	if record.Failed != "" {
+		return xerrors.Errorf("expert %s %s: %w", file.Expert, record.Failed, ErrExpertFailed)
 	}
+	record.History[file.Index] = file.ID
 	if err := t.saveRecord(file.Expert, record); err != nil {
 		return err
 	}
@@ -188,22 +303,51 @@ func (t *replayTask) replayFile(file *FileRef) error {
 
 	fileID, ok := record.History[record.Index]
 	if !ok {
-		log.WithFields(logrus.Fields{
-			"expert":  file.Expert,
-			"index":   record.Index,
-			"history": record.History,
-		}).Warn("nebula index file not found.")
-		return nil
+		return t.handleGap(file.Expert, record)
 	}
-	file, err := loadFile(t.storage, fileID)
+	record.GapSince = 0
+	file, err = loadFile(t.storage, fileID)
 	if err != nil {
 		return err
 	}
+	if file.Status < FileStatusImporting {
+		if err := t.setFileStatus(file, FileStatusImporting); err != nil {
+			return err
+		}
+	}
 	// update record
-	line, err := t.readFileAndWrite(file, record)
-	if line == 0 && err == nil {
+	counts := newImportCounts()
+	done, err := t.readFileAndWrite(file, record, counts)
+	if done && err == nil && file.Status < FileStatusImported {
+		if err = t.setFileStatus(file, FileStatusImported); err == nil {
+			t.bus.Publish(FileEventImported, file.ID)
+		}
+	}
+	if done && err == nil && t.rebuildDue(file, record) {
+		err = t.rebuildIndexes(file.Expert, record)
+	}
+	reimport := false
+	if done && err == nil {
+		reimport, err = t.reconcile(file, record, counts)
+	}
+	if reimport && err == nil {
+		done = false
+		record.Line = 0
+		record.Hash = ""
+		err = t.setFileStatus(file, FileStatusImporting)
+	}
+	if reimport && err == nil {
+		if err := t.clearJournal(file.Expert, record.Index); err != nil {
+			log.Errorf("failed to clear replay journal:%v", err)
+		}
+		log.WithFields(logrus.Fields{
+			"expert": file.Expert,
+			"index":  record.Index,
+		}).Warn("Reimport mismatched file.")
+	} else if done && err == nil {
 		record.Index++
 		record.Line = 0
+		record.Hash = ""
 		log.WithFields(logrus.Fields{
 			"expert": file.Expert,
 			"index":  record.Index,
@@ -218,7 +362,25 @@ func (t *replayTask) replayFile(file *FileRef) error {
 		return err
 	}
 
-	return t.saveRecord(file.Expert, record)
+	if err := t.saveRecord(file.Expert, record); err != nil {
+		return err
+	}
+	if done {
+		if err := t.clearJournal(file.Expert, record.Index-1); err != nil {
+			log.Errorf("failed to clear replay journal:%v", err)
+		}
+		if err := t.finishFile(file); err != nil {
+			return err
+		}
+		t.bus.Publish(FileEventReplayed, file.ID)
+		if caughtUp(record) && !t.pendingFiles(file.Expert) {
+			t.bus.Publish(ExpertEventCaughtUp, file.Expert)
+		}
+	}
+	if done && record.Shadow != "" && caughtUp(record) {
+		return t.cutOver(file.Expert, record)
+	}
+	return nil
 }
 
 func RecordKey(expert string) []byte {
@@ -229,6 +391,65 @@ func (t *replayTask) deleteRecord(expert string) error {
 	return t.storage.Del(RecordKey(expert))
 }
 
+func (t *replayTask) setFileStatus(file *FileRef, status Status) error {
+	file.Status = status
+	return saveFile(t.storage, file)
+}
+
+// finishFile marks a replayed file and removes it from the replay list.
+func (t *replayTask) finishFile(file *FileRef) error {
+	if err := t.setFileStatus(file, FileStatusReplaied); err != nil {
+		return err
+	}
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	delete(t.files, file.ID)
+	return saveDatas(t.storage, ReplayFilesKey, t.files, false)
+}
+
+// pendingFiles reports whether expert has files in the replay list.
+func (t *replayTask) pendingFiles(expert string) bool {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	for _, file := range t.files {
+		if file.Expert == expert {
+			return true
+		}
+	}
+	return false
+}
+
+// pruneFiles removes the files of an expert before its record index from the
+// replay list, they were replayed or advanced over.
+func (t *replayTask) pruneFiles(files []*FileRef) ([]*FileRef, error) {
+	record, err := t.expertRecord(files[0].Expert)
+	if err != nil {
+		return nil, err
+	}
+	pending := []*FileRef{}
+	pruned := []string{}
+	for _, file := range files {
+		if file.Index < record.Index {
+			pruned = append(pruned, file.ID)
+		} else {
+			pending = append(pending, file)
+		}
+	}
+	if len(pruned) == 0 {
+		return files, nil
+	}
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	for _, id := range pruned {
+		delete(t.files, id)
+	}
+	log.WithFields(logrus.Fields{
+		"expert": files[0].Expert,
+		"files":  pruned,
+	}).Info("remove finished replay files.")
+	return pending, saveDatas(t.storage, ReplayFilesKey, t.files, false)
+}
+
 func (t *replayTask) saveRecord(expert string, record *WriteRecord) error {
 	bytes, err := json.Marshal(record)
 	if err != nil {
@@ -250,16 +471,31 @@ func (t *replayTask) loadRecord(expert string) (*WriteRecord, error) {
 	return &data, nil
 }
 
-func (t *replayTask) readFileAndWrite(file *FileRef, record *WriteRecord) (int64, error) {
+// readFileAndWrite replays file from the checkpoint of record, it returns
+// whether the whole file is replayed.
+func (t *replayTask) readFileAndWrite(file *FileRef, record *WriteRecord, counts *importCounts) (bool, error) {
+	redo, err := t.recoverJournal(file.Expert, record)
+	if err != nil {
+		return false, err
+	}
+	transforms, err := expertTransforms(t.conf, file.Expert)
+	if err != nil {
+		return false, err
+	}
+	if mapping, ok := t.conf.Replay.Mappings[file.Expert]; ok {
+		return t.importFile(file, record, mapping, transforms, counts)
+	}
 	line := int64(0)
-	osfile, err := os.Open(file.Path)
+	osfile, err := utils.OpenDecompressed(file.LocalPath)
 	if err != nil {
-		return 0, err
+		return false, err
 	}
 	defer osfile.Close()
 	scanner := bufio.NewScanner(osfile)
 	scanner.Buffer([]byte{}, bufio.MaxScanTokenSize*100)
 	domain := ""
+	tctx := newTransformContext(file, domain)
+	batch := &replayBatch{task: t, file: file, record: record}
 	for scanner.Scan() {
 		line++
 		content := scanner.Text() // or
@@ -272,36 +508,59 @@ func (t *replayTask) readFileAndWrite(file *FileRef, record *WriteRecord) (int64
 		}).Debug("scan nebula file.")
 		// index := 0
 		if line == 1 {
-			headers := strings.Split(content, ",")
-			domains := strings.Split(headers[0], ":")
-			domain = strings.TrimSpace(domains[1])
-			// indexs := strings.Split(headers[1], ":")
-			// i, err := strconv.Atoi(indexs[1])
-			// if err != nil {
-			// 	return 0, err
-			// }
-			// index = i
+			header, err := parseFileHeader(content)
+			if err != nil {
+				return false, xerrors.Errorf("file %s: %w", file.ID, err)
+			}
+			domain = header.Domain
+			if err := t.checkDomain(file, record, domain); err != nil {
+				return false, err
+			}
 			log.WithFields(logrus.Fields{
-				"id":     file.ID,
-				"domain": domain,
-				"expert": file.Expert,
+				"id":      file.ID,
+				"domain":  domain,
+				"version": header.Version,
+				"expert":  file.Expert,
 			}).Info("expert nebula header.")
-			// if record.Index == 1 {
-			// 	if err := t.writeToNebulaSql(line, domain, ""); err != nil {
-			// 		return line - 1, err
-			// 	}
-			// }
 			record.Domain = domain
 		} else {
 			// if record.Index > index {
 			// 	continue
 			// }
 			if line <= record.Line {
+				if err := checkpointHash(record, line, content); err != nil {
+					return false, xerrors.Errorf("file %s: %w", file.ID, err)
+				}
+				// upserts replayed before a restart still rule out a reimport.
+				if stmts, err := graph.ParseNGQL(content); err == nil {
+					counts.addUpserts(stmts)
+				}
 				continue
 			}
-			if strings.Contains(strings.ToUpper(content), "CREATE SPACE") {
-				contents := strings.Split(content, " ")
-				space := strings.TrimSpace(contents[5])
+			stmts, err := graph.ParseNGQL(content)
+			if err != nil {
+				return false, xerrors.Errorf("failed to parse line:%d, %w", line, err)
+			}
+			if len(stmts) == 0 {
+				continue
+			}
+			stmts, err = t.allowStatements(file, record, line, stmts)
+			if err != nil {
+				return false, err
+			}
+			tctx.Line, tctx.Space = line, domain
+			stmts, err = applyTransforms(transforms, tctx, stmts)
+			if err != nil {
+				return false, xerrors.Errorf("failed to transform line:%d, %w", line, err)
+			}
+			if len(stmts) == 0 {
+				continue
+			}
+			counts.add(stmts)
+			if space := createdSpace(stmts); space != "" {
+				if err := batch.flush(); err != nil {
+					return false, err
+				}
 				log.WithFields(logrus.Fields{
 					"id":      file.ID,
 					"space":   space,
@@ -318,143 +577,185 @@ func (t *replayTask) readFileAndWrite(file *FileRef, record *WriteRecord) (int64
 				domain = t.conf.Server.ExpertSpaces[file.Expert]
 				record.Domain = domain
 				if len(domain) == 0 {
-					return line - 1, fmt.Errorf("failed to find domain. expert:%s, index:%d", file.Expert, record.Index)
+					return false, fmt.Errorf("failed to find domain. expert:%s, index:%d", file.Expert, record.Index)
 				}
 			}
-			if err := t.writeToNebulaSql(line, domain, content); err != nil {
-				return line - 1, err
+			hash := lineHash(content)
+			if isInsert(stmts) {
+				if err := batch.add(domain, line, stmts, hash, graph.Idempotent(stmts)); err != nil {
+					return false, err
+				}
+				continue
+			}
+			if err := batch.flush(); err != nil {
+				return false, err
 			}
-			record.Line = line
-			if err := t.saveRecord(file.Expert, record); err != nil {
-				return line, err
+			redone := redo != nil && line >= redo.Start && line <= redo.End
+			err = t.applyLines(file.Expert, record, line, line, hash, graph.Idempotent(stmts), func() error {
+				if err := t.writeToNebulaSql(file.Expert, line, domain, stmts, redone); err != nil {
+					return err
+				}
+				for _, kind := range t.rebuildKinds(file.Expert, domain, stmts) {
+					record.markRebuild(domain, kind)
+				}
+				return nil
+			})
+			if err != nil {
+				return false, err
 			}
 		}
 	}
 
 	if err := scanner.Err(); err != nil {
-		return line, err
+		return false, err
+	}
+	if err := batch.flush(); err != nil {
+		return false, err
 	}
-	return 0, nil
+	return true, nil
 }
 
-func (t *replayTask) dropSpace(space string) error {
-	sql := fmt.Sprintf("DROP SPACE IF EXISTS %s;", space)
-	return t.writeToNebulaSql(0, space, sql)
+// checkpointHash verifies the checkpointed line of record is still line, so
+// a changed file is never resumed at a wrong line.
+func checkpointHash(record *WriteRecord, line int64, content string) error {
+	if line != record.Line || record.Hash == "" || lineHash(content) == record.Hash {
+		return nil
+	}
+	return xerrors.Errorf("line:%d differs from the replay checkpoint", line)
 }
 
-func (t *replayTask) NebulaPool() (*nebula.ConnectionPool, error) {
-	if t.nebulasPool == nil {
-		host := nebula.HostAddress{Host: t.conf.Nebula.Address, Port: t.conf.Nebula.Port}
-		hostList := []nebula.HostAddress{host}
-		poolConf := nebula.GetDefaultConf()
-		pool, err := nebula.NewConnectionPool(hostList, poolConf, nebLog)
-		if err != nil {
-			return nil, err
+// replayBatch groups consecutive insert statements of a file, the record
+// line is checkpointed after every executed batch.
+type replayBatch struct {
+	task   *replayTask
+	file   *FileRef
+	record *WriteRecord
+
+	space string
+	start int64
+	end   int64
+	hash  string
+	idem  bool
+	lines int
+	stmts []*graph.Statement
+}
+
+func (b *replayBatch) add(space string, line int64, stmts []*graph.Statement, hash string, idem bool) error {
+	if len(b.stmts) > 0 && b.space != space {
+		if err := b.flush(); err != nil {
+			return err
 		}
-		t.nebulasPool = pool
 	}
-	return t.nebulasPool, nil
+	if len(b.stmts) == 0 {
+		b.space = space
+		b.start = line
+		b.lines = 0
+		b.idem = true
+	}
+	b.end = line
+	b.hash = hash
+	b.idem = b.idem && idem
+	b.lines++
+	b.stmts = append(b.stmts, stmts...)
+	if b.lines >= b.task.conf.Replay.BatchSize {
+		return b.flush()
+	}
+	return nil
 }
 
-func (t *replayTask) writeToNebulaSql(line int64, space string, content string) error {
-	_, err := t.NebulaPool()
-	if err != nil {
-		return err
+func (b *replayBatch) flush() error {
+	if len(b.stmts) == 0 {
+		return nil
 	}
-
-	session, err := t.nebulasPool.GetSession(t.conf.Nebula.UserName, t.conf.Nebula.Password)
+	err := b.task.applyLines(b.file.Expert, b.record, b.start, b.end, b.hash, b.idem, func() error {
+		return b.task.store.Upsert(b.task.nebulaSpace(b.file.Expert, b.space), b.stmts)
+	})
 	if err != nil {
-		return err
+		return xerrors.Errorf("nebula batch lines:%d-%d, %w", b.start, b.end, err)
 	}
-	defer session.Release()
-
-	{
-		// createSchema := "CREATE SPACE IF NOT EXISTS basic_example_space(vid_type=FIXED_STRING(20)); " +
-		// 	"USE basic_example_space;" +
-		// 	"CREATE TAG IF NOT EXISTS person(name string, age int);" +
-		// 	"CREATE EDGE IF NOT EXISTS like(likeness double)"
-		sql := ""
-		// if line == 0 {
-		// 	sql = fmt.Sprintf("CREATE SPACE IF NOT EXISTS %s(vid_type=FIXED_STRING(64));", space)
-		// } else
-		{
-			useSql := ""
-			if !strings.Contains(strings.ToUpper(content), "CREATE SPACE") {
-				useSql = fmt.Sprintf("USE %s;", space)
-			}
-			sql = useSql + content
+	log.WithFields(logrus.Fields{
+		"id":    b.file.ID,
+		"space": b.space,
+		"start": b.start,
+		"end":   b.end,
+	}).Debug("write nebula batch.")
+	b.stmts = b.stmts[:0]
+	return nil
+}
+
+// dropSpace drops the nebula space serving space.
+func (t *replayTask) dropSpace(expert string, space string) error {
+	return t.dropNebulaSpace(expert, t.nebulaSpace(expert, space))
+}
+
+// dropNebulaSpace drops a nebula space of expert.
+func (t *replayTask) dropNebulaSpace(expert string, space string) error {
+	log.WithFields(logrus.Fields{
+		"expert": expert,
+		"space":  space,
+	}).Warn("drop nebula space.")
+	return t.store.DropSpace(space)
+}
+
+// createdSpace returns the last space created by stmts.
+func createdSpace(stmts []*graph.Statement) string {
+	space := ""
+	for _, stmt := range stmts {
+		if stmt.Kind == graph.StatementCreateSpace {
+			space = stmt.Space
 		}
-		if strings.Contains(strings.ToUpper(sql), "CREATE TAG") {
-			strs := strings.Split(content, "(")
-			strs = strings.Split(strs[0], " ")
-			tag := strs[len(strs)-1]
-			wrap := tag
-			sql, wrap = replaceReservedFields(sql, tag)
-			sql += fmt.Sprintf("CREATE TAG INDEX IF NOT EXISTS i_%s_value on %s(value(16));", tag, wrap)
-		} else if strings.Contains(strings.ToUpper(sql), "CREATE EDGE") {
-			strs := strings.Split(content, "(")
-			strs = strings.Split(strs[0], " ")
-			edge := strs[len(strs)-1]
-			wrap := edge
-			sql, wrap = replaceReservedFields(sql, edge)
-			sql += fmt.Sprintf("CREATE EDGE INDEX IF NOT EXISTS i_%s_name on %s(name(16));", edge, wrap)
-		} else {
-			strs := strings.Split(content, "(")
-			strs = strings.Split(strs[0], " ")
-			sfield := strs[len(strs)-1]
-			sql, _ = replaceReservedFields(sql, sfield)
+	}
+	return space
+}
+
+func isInsert(stmts []*graph.Statement) bool {
+	for _, stmt := range stmts {
+		if !stmt.IsInsert() {
+			return false
 		}
-		// sql = fmt.Sprintf("DROP SPACE IF EXISTS %s;", space)
-		resultSet, err := session.Execute(sql)
-		if err != nil {
-			return err
+	}
+	return len(stmts) > 0
+}
+
+// writeToNebulaSql creates the schemas of stmts with their indexes and
+// writes their vertices and edges in order, on redo schemas already created
+// are tolerated.
+func (t *replayTask) writeToNebulaSql(expert string, line int64, space string, stmts []*graph.Statement, redo bool) error {
+	t.nebulaStatements(expert, stmts)
+	nebulaSpace := t.nebulaSpace(expert, space)
+	run := []*graph.Statement{}
+	applied := false
+	flush := func() error {
+		if len(run) == 0 {
+			return nil
 		}
-		if !resultSet.IsSucceed() {
-			return xerrors.Errorf("nebula execute error line:%d, sql:%s, code:%d, message:%s", line, sql, resultSet.GetErrorCode(), resultSet.GetErrorMsg())
+		var err error
+		if run[0].IsInsert() {
+			err = t.store.Upsert(nebulaSpace, run)
+		} else if err = t.store.CreateSchema(nebulaSpace, run, redo); err == nil {
+			err = t.registerSchema(expert, space, run)
 		}
-		if strings.Contains(strings.ToUpper(sql), "CREATE") {
-			time.Sleep(5 * time.Second)
+		run = run[:0]
+		if err != nil && applied {
+			return &partlyApplied{err}
 		}
+		applied = true
+		return err
 	}
-	return nil
-}
-
-func replaceReservedFields(sql string, sfield string) (string, string) {
-	for _, field := range ReservedFields {
-		if field == strings.ToUpper(sfield) {
-			upSql := strings.ToUpper(sql)
-			fields := make(map[int]string)
-			for {
-				i := strings.Index(upSql, strings.ToUpper(sfield))
-				if i == -1 {
-					break
-				}
-				start := len(sql) - len(upSql) + i
-				fields[start] = sql[start : start+len(field)]
-				upSql = upSql[i+len(sfield):]
-			}
-			sfields := []string{}
-			for i, f := range fields {
-				if i > 0 && (sql[i-1:i] == " " || sql[i-1:i] == "`" || sql[i-1:i] == "\"" || sql[i-1:i] == "'") {
-					sfields = append(sfields, f)
-				}
+	for _, stmt := range stmts {
+		if len(run) > 0 && run[0].IsInsert() != stmt.IsInsert() {
+			if err := flush(); err != nil {
+				return xerrors.Errorf("nebula line:%d, %w", line, err)
 			}
-			wrapSql := sql
-			for _, sf := range sfields {
-				wrap := fmt.Sprintf("`%s`", sf)
-				wrapSql = strings.ReplaceAll(wrapSql, sf, wrap)
-			}
-
-			log.WithFields(logrus.Fields{
-				"fields":  sfields,
-				"sql":     sql,
-				"wrapSql": wrapSql,
-			}).Warn("replace for reserved fields.")
-			// panic(sql)
-			return wrapSql, fmt.Sprintf("`%s`", sfield)
 		}
+		indexes, _ := t.indexStatements(expert, space, stmt)
+		run = append(run, stmt)
+		run = append(run, indexes...)
 	}
-	return sql, sfield
+	if err := flush(); err != nil {
+		return xerrors.Errorf("nebula line:%d, %w", line, err)
+	}
+	return nil
 }
 
 // func (t *replayTask) createTagIndex(domain string) error {
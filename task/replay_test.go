@@ -0,0 +1,146 @@
+package task
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/EpiK-Protocol/go-epik-gateway/app/config"
+	"github.com/EpiK-Protocol/go-epik-gateway/graph"
+	"github.com/EpiK-Protocol/go-epik-gateway/storage"
+	"github.com/asaskevich/EventBus"
+	"github.com/sirupsen/logrus"
+)
+
+func TestMain(m *testing.M) {
+	log = logrus.New()
+	log.SetLevel(logrus.ErrorLevel)
+	os.Exit(m.Run())
+}
+
+// newTestReplay returns a replay task on memory storage and graph store.
+func newTestReplay(t *testing.T, conf config.Config) (*replayTask, *graph.MemoryStore) {
+	st, err := storage.NewMemoryStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := graph.NewMemoryStore()
+	return newTestReplayOn(t, conf, st, store), store
+}
+
+// newTestReplayOn returns a replay task on st and store, a new one on the
+// same storage and store restarts the replay.
+func newTestReplayOn(t *testing.T, conf config.Config, st storage.Storage, store graph.GraphStore) *replayTask {
+	task, err := newReplayTask(conf, st, EventBus.New(), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	task.files = map[string]*FileRef{}
+	return task
+}
+
+// writeExpertFile saves the file index of expert with lines to replay.
+func writeExpertFile(t *testing.T, st storage.Storage, expert string, index int64, lines ...string) *FileRef {
+	path := filepath.Join(t.TempDir(), fmt.Sprintf("%s-%d.ngql", expert, index))
+	if err := ioutil.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	file := &FileRef{ID: fmt.Sprintf("%s-%d", expert, index), Index: index, Expert: expert, LocalPath: path, Status: FileStatusDownloaded}
+	if err := saveFile(st, file); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func parseNGQL(t *testing.T, sql string) []*graph.Statement {
+	stmts, err := graph.ParseNGQL(sql)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stmts
+}
+
+func TestReplayMemoryStore(t *testing.T) {
+	conf := config.Config{}
+	conf.Replay.Reconcile = true
+	task, store := newTestReplay(t, conf)
+	files := []*FileRef{
+		writeExpertFile(t, task.storage, "ex", 1, "domain:sp,index:1",
+			"CREATE SPACE IF NOT EXISTS sp(vid_type=FIXED_STRING(8));USE sp;CREATE TAG person(name string, age int);CREATE EDGE like(w double)",
+			"CREATE TAG INDEX person_name ON person(name(8))",
+			`INSERT VERTEX person(name, age) VALUES "a":("A", 1), "b":("B", 2)`,
+			`INSERT EDGE like(w) VALUES "a"->"b":(0.5), "b"->"a"@1:(1.5)`),
+		writeExpertFile(t, task.storage, "ex", 2, "domain:sp,index:2",
+			`UPSERT VERTEX ON person "a" SET age = 3`,
+			`INSERT VERTEX person(name, age) VALUES "c":("C", 4)`,
+			`UPSERT EDGE ON like "a"->"b" SET w = 2.5`),
+	}
+	for _, file := range files {
+		if err := task.replayFile(file); err != nil {
+			t.Fatal(err)
+		}
+	}
+	record, err := task.expertRecord("ex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Index != 3 {
+		t.Fatalf("record index %d", record.Index)
+	}
+
+	schema, err := store.Schema("sp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schema.Tags["person"]) != 2 || len(schema.Edges["like"]) != 1 || schema.Indexes["person_name"] == nil {
+		t.Errorf("schema %+v", schema)
+	}
+	stats, err := store.Stats("sp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Vertices != 3 || stats.Relations != 2 || stats.Tags["person"] != 3 || stats.Edges["like"] != 2 {
+		t.Errorf("stats %+v", stats)
+	}
+
+	vertices := map[string]map[string]interface{}{}
+	edges := []*graph.Edge{}
+	err = store.Export("sp", func(v *graph.Vertex) error {
+		vertices[v.ID] = v.Props
+		return nil
+	}, func(e *graph.Edge) error {
+		edges = append(edges, e)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]map[string]interface{}{
+		"a": {"person.name": "A", "person.age": int64(3)},
+		"b": {"person.name": "B", "person.age": int64(2)},
+		"c": {"person.name": "C", "person.age": int64(4)},
+	}
+	if !reflect.DeepEqual(vertices, want) {
+		t.Errorf("vertices %v", vertices)
+	}
+	if len(edges) != 2 || edges[0].Src != "a" || edges[0].Props["w"] != 2.5 || edges[1].Rank != 1 || edges[1].Props["w"] != 1.5 {
+		t.Errorf("edges %+v %+v", edges[0], edges[1])
+	}
+
+	result, err := task.Reconciliation("ex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Reports) != len(files) {
+		t.Fatalf("%d reconcile reports", len(result.Reports))
+	}
+	for _, report := range result.Reports {
+		if report.Status != ReconcileMatched {
+			t.Errorf("report %+v", report)
+		}
+	}
+}
@@ -0,0 +1,278 @@
+package task
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/EpiK-Protocol/go-epik-gateway/app/config"
+	"github.com/EpiK-Protocol/go-epik-gateway/storage"
+	"github.com/EpiK-Protocol/go-epik-gateway/utils"
+	"github.com/asaskevich/EventBus"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+var (
+	RetentionFilesKey = []byte("task:retention")
+
+	ErrInsufficientSpace = xerrors.New("insufficient free space in data dir")
+)
+
+type retentionTask struct {
+	conf    config.Config
+	storage storage.Storage
+	bus     EventBus.Bus
+
+	lk sync.Mutex
+	// replayed file ids, oldest first.
+	files []string
+}
+
+func newRetentionTask(conf config.Config, st storage.Storage, bus EventBus.Bus) (*retentionTask, error) {
+	files, err := loadFileList(st, RetentionFilesKey)
+	if err != nil {
+		return nil, err
+	}
+
+	task := &retentionTask{
+		conf:    conf,
+		storage: st,
+		bus:     bus,
+		files:   files,
+	}
+
+	task.bus.SubscribeAsync(FileEventReplayed, task.handleReplayed, true)
+
+	return task, nil
+}
+
+func (t *retentionTask) handleReplayed(fileID string) {
+	file, err := loadFile(t.storage, fileID)
+	if err != nil {
+		log.Errorf("failed to load file info:%s", fileID)
+		return
+	}
+
+	switch t.conf.Storage.ReplayedPolicy {
+	case config.RetentionDelete:
+		if _, err := removeLocalFile(file); err != nil {
+			log.WithFields(logrus.Fields{
+				"id":    file.ID,
+				"error": err,
+			}).Error("failed to delete replayed file.")
+			return
+		}
+	case config.RetentionCompress:
+		if err := compressLocalFile(t.storage, file, utils.CodecGzip); err != nil {
+			log.WithFields(logrus.Fields{
+				"id":    file.ID,
+				"error": err,
+			}).Error("failed to compress replayed file.")
+			return
+		}
+	}
+
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	t.files = append(t.files, fileID)
+	if err := saveFileList(t.storage, RetentionFilesKey, t.files); err != nil {
+		log.Errorf("failed to save file info:%v", err)
+	}
+}
+
+// process evicts the oldest replayed files until data dir fits in max size.
+func (t *retentionTask) process(ctx context.Context) error {
+	if t.conf.Storage.MaxDataSize <= 0 {
+		return nil
+	}
+	size, err := utils.DirSize(t.conf.Storage.DataDir)
+	if err != nil {
+		return err
+	}
+
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	evicted := 0
+	for size > t.conf.Storage.MaxDataSize && evicted < len(t.files) {
+		file, err := loadFile(t.storage, t.files[evicted])
+		if err != nil && err != storage.ErrKeyNotFound {
+			return err
+		}
+		if file != nil {
+			removed, err := removeLocalFile(file)
+			if err != nil {
+				return err
+			}
+			size -= removed
+			log.WithFields(logrus.Fields{
+				"id":      file.ID,
+				"size":    removed,
+				"dirSize": size,
+			}).Info("evict replayed file.")
+		}
+		evicted++
+	}
+	if evicted == 0 {
+		return nil
+	}
+	t.files = t.files[evicted:]
+	if size > t.conf.Storage.MaxDataSize {
+		log.WithFields(logrus.Fields{
+			"dirSize": size,
+			"maxSize": t.conf.Storage.MaxDataSize,
+		}).Warn("data dir exceeds max size with no replayed file left.")
+	}
+	return saveFileList(t.storage, RetentionFilesKey, t.files)
+}
+
+func (t *retentionTask) stop() {
+	t.bus.WaitAsync()
+}
+
+// removeLocalFile deletes the local copy of file, returns the bytes released.
+// Nothing is released while another hard link keeps the content.
+func removeLocalFile(file *FileRef) (int64, error) {
+	info, err := os.Stat(file.LocalPath)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if err := os.Remove(file.LocalPath); err != nil {
+		return 0, err
+	}
+	if utils.FileLinks(info) > 1 {
+		return 0, nil
+	}
+	return info.Size(), nil
+}
+
+// compressLocalFile replaces the local copy of file with a compressed one,
+// content compressed already is kept.
+func compressLocalFile(st storage.Storage, file *FileRef, codec string) error {
+	if isCompressedPath(file.LocalPath) {
+		return nil
+	}
+	exist, err := utils.Exists(file.LocalPath)
+	if err != nil || !exist {
+		return err
+	}
+	if current, err := utils.FileCodec(file.LocalPath); err != nil || current != utils.CodecNone {
+		return err
+	}
+	path := file.LocalPath + utils.CodecExt(codec)
+	if err := utils.CompressFile(file.LocalPath, path, codec); err != nil {
+		os.Remove(path)
+		return err
+	}
+	raw := file.LocalPath
+	file.LocalPath = path
+	if err := saveFile(st, file); err != nil {
+		file.LocalPath = raw
+		os.Remove(path)
+		return err
+	}
+	log.WithFields(logrus.Fields{
+		"id":    file.ID,
+		"path":  path,
+		"codec": codec,
+	}).Info("compress local file.")
+	return os.Remove(raw)
+}
+
+func isCompressedPath(path string) bool {
+	ext := filepath.Ext(path)
+	return ext == utils.CodecExt(utils.CodecGzip) || ext == utils.CodecExt(utils.CodecZstd)
+}
+
+// hasFreeSpace reports whether data dir is above the free space threshold.
+func hasFreeSpace(conf config.Config) bool {
+	return ensureFreeSpace(conf, 0) == nil
+}
+
+// ensureFreeSpace checks that size bytes can be written to data dir
+// without crossing the free space threshold.
+func ensureFreeSpace(conf config.Config, size int64) error {
+	if conf.Storage.MinFreeSpace <= 0 {
+		return nil
+	}
+	free, err := utils.DiskFree(conf.Storage.DataDir)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"dir":   conf.Storage.DataDir,
+			"error": err,
+		}).Warn("failed to check free space.")
+		return nil
+	}
+	if int64(free)-size < conf.Storage.MinFreeSpace {
+		return xerrors.Errorf("%w: free:%d, need:%d, min:%d", ErrInsufficientSpace, free, size, conf.Storage.MinFreeSpace)
+	}
+	return nil
+}
+
+// CollectGarbage removes files in data dir which no FileRef references,
+// returns the removed paths. Nothing is removed when dryRun is set.
+func CollectGarbage(conf config.Config, st storage.Storage, dryRun bool) ([]string, error) {
+	initLog()
+
+	refs := make(map[string]bool)
+	err := st.Iterate(nil, func(key []byte, value []byte) error {
+		if bytes.HasPrefix(key, []byte("task:")) {
+			return nil
+		}
+		var file FileRef
+		if err := file.Unmarshal(value); err != nil || file.ID != string(key) {
+			return nil
+		}
+		for _, path := range []string{file.Path, file.LocalPath} {
+			if len(path) > 0 {
+				refs[absPath(path)] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	infos, err := ioutil.ReadDir(conf.Storage.DataDir)
+	if err != nil {
+		return nil, err
+	}
+	orphans := []string{}
+	for _, info := range infos {
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		path := filepath.Join(conf.Storage.DataDir, info.Name())
+		if refs[absPath(path)] {
+			continue
+		}
+		orphans = append(orphans, path)
+		if dryRun {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			return orphans, err
+		}
+		log.WithFields(logrus.Fields{
+			"path": path,
+			"size": info.Size(),
+		}).Info("remove orphaned file.")
+	}
+	return orphans, nil
+}
+
+// absPath returns the cleaned absolute path, so relative and absolute paths
+// of a file compare equal.
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
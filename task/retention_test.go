@@ -0,0 +1,123 @@
+package task
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/EpiK-Protocol/go-epik-gateway/app/config"
+	"github.com/EpiK-Protocol/go-epik-gateway/storage"
+	"github.com/EpiK-Protocol/go-epik-gateway/utils"
+)
+
+func writeTestFile(t *testing.T, path string, size int) {
+	if err := ioutil.WriteFile(path, make([]byte, size), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectGarbageRelativeDataDir(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rel, err := filepath.Rel(wd, dir)
+	if err != nil {
+		t.Skip(err)
+	}
+	st, err := storage.NewMemoryStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	live := filepath.Join(dir, "live")
+	orphan := filepath.Join(dir, "orphan")
+	writeTestFile(t, live, 1)
+	writeTestFile(t, orphan, 1)
+	if err := saveFile(st, &FileRef{ID: "f", LocalPath: live}); err != nil {
+		t.Fatal(err)
+	}
+
+	conf := config.Config{}
+	conf.Storage.DataDir = "./" + rel
+	removed, err := CollectGarbage(conf, st, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 || absPath(removed[0]) != orphan {
+		t.Errorf("removed %v", removed)
+	}
+	if _, err := os.Stat(live); err != nil {
+		t.Errorf("live file removed: %v", err)
+	}
+}
+
+func TestLinkedFileSize(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "a")
+	writeTestFile(t, src, 100)
+	if err := os.Link(src, filepath.Join(dir, "b")); err != nil {
+		t.Skip(err)
+	}
+	writeTestFile(t, filepath.Join(dir, "c"), 10)
+	size, err := utils.DirSize(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 110 {
+		t.Errorf("dir size %d", size)
+	}
+
+	removed, err := removeLocalFile(&FileRef{LocalPath: src})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 0 {
+		t.Errorf("removing a linked file released %d", removed)
+	}
+	removed, err = removeLocalFile(&FileRef{LocalPath: filepath.Join(dir, "b")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 100 {
+		t.Errorf("removing the last link released %d", removed)
+	}
+}
+
+func TestCompressLocalFile(t *testing.T) {
+	content := []byte("domain:sp,index:1\nUSE sp\n")
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write(content)
+	w.Close()
+	dir := t.TempDir()
+	for name, data := range map[string][]byte{"raw": content, "gzipped": gz.Bytes()} {
+		st, err := storage.NewMemoryStorage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		file := &FileRef{ID: name, LocalPath: path}
+		if err := compressLocalFile(st, file, utils.CodecZstd); err != nil {
+			t.Fatal(err)
+		}
+		if compressed := file.LocalPath != path; compressed != (name == "raw") {
+			t.Errorf("%s: compressed into %s", name, file.LocalPath)
+		}
+		r, err := utils.OpenDecompressed(file.LocalPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil || !bytes.Equal(got, content) {
+			t.Errorf("%s: read %q, %v", name, got, err)
+		}
+	}
+}
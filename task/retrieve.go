@@ -1,13 +1,12 @@
 package task
 
 import (
-	"bufio"
 	"context"
 	"fmt"
+	"io"
 	"os"
-	"strconv"
-	"strings"
 	"sync"
+	"time"
 
 	"github.com/EpiK-Protocol/go-epik-gateway/app/config"
 	"github.com/EpiK-Protocol/go-epik-gateway/epik/api"
@@ -31,6 +30,7 @@ type retrieveTask struct {
 	conf    config.Config
 	storage storage.Storage
 	bus     EventBus.Bus
+	limiter *transferLimiter
 
 	lk      sync.Mutex
 	files   map[string]*FileRef
@@ -42,7 +42,7 @@ type retrieveTask struct {
 	quitChs      map[string]chan bool
 }
 
-func newRetrieveTask(conf config.Config, st storage.Storage, bus EventBus.Bus) (*retrieveTask, error) {
+func newRetrieveTask(conf config.Config, st storage.Storage, bus EventBus.Bus, limiter *transferLimiter) (*retrieveTask, error) {
 
 	err := os.MkdirAll(conf.Storage.DataDir, os.ModePerm)
 	if err != nil {
@@ -53,6 +53,7 @@ func newRetrieveTask(conf config.Config, st storage.Storage, bus EventBus.Bus) (
 		conf:         conf,
 		storage:      st,
 		bus:          bus,
+		limiter:      limiter,
 		files:        nil,
 		experts:      conf.Server.Experts,
 		quitChs:      make(map[string]chan bool),
@@ -129,6 +130,11 @@ func (t *retrieveTask) retrieveData(ctx context.Context) error {
 			continue
 		}
 
+		if !t.limiter.inWindow(time.Now()) {
+			log.Debug("outside transfer window, skip retrieve.")
+			return nil
+		}
+
 		exist, err := utils.Exists(file.LocalPath)
 		if err != nil {
 			return err
@@ -137,6 +143,17 @@ func (t *retrieveTask) retrieveData(ctx context.Context) error {
 			return t.updateFileStatus(file)
 		}
 
+		linked, err := linkContent(t.conf, t.storage, file)
+		if err != nil {
+			return err
+		}
+		if linked {
+			if err := t.updateFileStatus(file); err != nil {
+				return err
+			}
+			continue
+		}
+
 		chain := t.conf.Chains[0]
 
 		conf := utils.SSHConfig{
@@ -176,7 +193,7 @@ func (t *retrieveTask) retrieveData(ctx context.Context) error {
 				}
 			}
 		}
-		if err := t.downloadFile(conf, file); err != nil {
+		if err := t.downloadFile(ctx, conf, file); err != nil {
 			return err
 		}
 	}
@@ -285,6 +302,11 @@ func (t *retrieveTask) exportFile(ctx context.Context, chain config.Chain, file
 		return fmt.Errorf("failed to parse file pieceID:%s", data.PieceCID)
 	}
 
+	// the export is kept inside the windows, it runs on the node and the
+	// exported file is throttled when it is downloaded.
+	if err := t.limiter.waitWindow(ctx); err != nil {
+		return err
+	}
 	return client.ClientExport(ctx, api.ExportRef{Root: file.RootCID}, api.FileRef{Path: file.Path})
 }
 
@@ -303,7 +325,7 @@ func (t *retrieveTask) retrieveFile(conf utils.SSHConfig, chain config.Chain, fi
 	return nil
 }
 
-func (t *retrieveTask) downloadFile(conf utils.SSHConfig, file *FileRef) error {
+func (t *retrieveTask) downloadFile(ctx context.Context, conf utils.SSHConfig, file *FileRef) error {
 	exist, err := utils.Exists(file.LocalPath)
 	if err != nil {
 		return err
@@ -312,7 +334,14 @@ func (t *retrieveTask) downloadFile(conf utils.SSHConfig, file *FileRef) error {
 		return nil
 	}
 
-	err = utils.SCPFileFromRemote(conf, file.Path, file.LocalPath)
+	if err := ensureFreeSpace(t.conf, file.FileSize); err != nil {
+		return err
+	}
+
+	conf.Timeout = t.limiter.timeout(conf.IP, file.FileSize)
+	err = utils.SCPFileFromRemotePassThru(conf, file.Path, file.LocalPath, func(r io.Reader, total int64) io.Reader {
+		return t.limiter.Reader(ctx, conf.IP, r, true)
+	})
 	if err != nil {
 		log.WithFields(logrus.Fields{
 			"id":        file.ID,
@@ -326,19 +355,26 @@ func (t *retrieveTask) downloadFile(conf utils.SSHConfig, file *FileRef) error {
 }
 
 func (t *retrieveTask) updateFileStatus(file *FileRef) error {
-	index, err := parseFileIndex(file.LocalPath)
-	if err != nil {
+	file.Index = 0
+	if _, err := validateFile(file); err != nil {
 		return err
 	}
-	file.Index = int64(index)
+	if codec := t.conf.Storage.Compression; codec != utils.CodecNone {
+		if err := compressLocalFile(t.storage, file, codec); err != nil {
+			return err
+		}
+	}
 	file.Status = FileStatusDownloaded
-	err = saveFile(t.storage, file)
-	if err != nil {
+	if err := saveFile(t.storage, file); err != nil {
 		return err
 	}
 
 	log.Info("file downloaded:", file.ID)
 
+	if err := addContent(t.storage, file); err != nil {
+		log.Errorf("failed to index file content:%v", err)
+	}
+
 	t.bus.Publish(FileEventDownloaded, file.ID)
 
 	return nil
@@ -350,29 +386,6 @@ func (t *retrieveTask) stop() {
 	}
 }
 
-func parseFileIndex(file string) (int, error) {
-	fi, err := os.Open(file)
-	if err != nil {
-		return 0, err
-	}
-	defer fi.Close()
-
-	br := bufio.NewReader(fi)
-	content, _, err := br.ReadLine()
-	if err != nil {
-		return 0, err
-	}
-	headers := strings.Split(string(content), ",")
-	// domains := strings.Split(headers[0], ":")
-	// domain = strings.TrimSpace(domains[1])
-	indexs := strings.Split(headers[1], ":")
-	i, err := strconv.Atoi(indexs[1])
-	if err != nil {
-		return 0, err
-	}
-	return i, nil
-}
-
 func getFullAPI(ctx context.Context, chain config.Chain) (api.FullNode, jsonrpc.ClientCloser, error) {
 	ainfo := api.APIInfo{
 		Addr:  chain.RPCHost,
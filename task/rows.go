@@ -0,0 +1,257 @@
+package task
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+
+	"github.com/EpiK-Protocol/go-epik-gateway/app/config"
+	"github.com/EpiK-Protocol/go-epik-gateway/utils"
+	"github.com/xitongsys/parquet-go-source/buffer"
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/source"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// ParquetHeaderKey is the footer metadata key holding the file header.
+	ParquetHeaderKey = "epik_header"
+
+	parquetReadRows = 1000
+)
+
+var parquetMagic = []byte("PAR1")
+
+// rowReader yields the records of a structured data file keyed by column,
+// io.EOF is returned after the last record.
+type rowReader interface {
+	Next() (map[string]interface{}, error)
+	Close() error
+}
+
+// openRows opens a structured data file and returns its header and records.
+func openRows(file *FileRef, mapping config.Mapping) (*FileHeader, rowReader, error) {
+	if mapping.Format == config.FormatParquet {
+		return openParquetRows(file)
+	}
+
+	fi, err := utils.OpenDecompressed(file.LocalPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	br := bufio.NewReader(fi)
+	line, err := br.ReadString('\n')
+	if err != nil && err != io.EOF {
+		fi.Close()
+		return nil, nil, err
+	}
+	header, err := parseFileHeader(line)
+	if err != nil {
+		fi.Close()
+		return nil, nil, xerrors.Errorf("file %s: %w", file.ID, err)
+	}
+
+	switch mapping.Format {
+	case config.FormatCSV:
+		r := csv.NewReader(br)
+		if mapping.Delimiter != "" {
+			r.Comma = []rune(mapping.Delimiter)[0]
+		}
+		r.FieldsPerRecord = -1
+		columns, err := r.Read()
+		if err != nil {
+			fi.Close()
+			return nil, nil, xerrors.Errorf("file %s: failed to read csv columns: %w", file.ID, err)
+		}
+		return header, &csvRows{closer: fi, reader: r, columns: columns}, nil
+	case config.FormatJSONL:
+		return header, &jsonlRows{closer: fi, reader: br}, nil
+	}
+	fi.Close()
+	return nil, nil, xerrors.Errorf("unknown data format: %s", mapping.Format)
+}
+
+type csvRows struct {
+	closer  io.Closer
+	reader  *csv.Reader
+	columns []string
+}
+
+func (r *csvRows) Next() (map[string]interface{}, error) {
+	values, err := r.reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	row := make(map[string]interface{}, len(r.columns))
+	for i, column := range r.columns {
+		if i < len(values) {
+			row[column] = values[i]
+		}
+	}
+	return row, nil
+}
+
+func (r *csvRows) Close() error {
+	return r.closer.Close()
+}
+
+type jsonlRows struct {
+	closer io.Closer
+	reader *bufio.Reader
+}
+
+func (r *jsonlRows) Next() (map[string]interface{}, error) {
+	for {
+		line, err := r.reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			row := map[string]interface{}{}
+			decoder := json.NewDecoder(bytes.NewReader(line))
+			decoder.UseNumber()
+			if err := decoder.Decode(&row); err != nil {
+				return nil, err
+			}
+			return row, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (r *jsonlRows) Close() error {
+	return r.closer.Close()
+}
+
+type parquetRows struct {
+	file   source.ParquetFile
+	reader *reader.ParquetReader
+	names  map[string]string
+	rows   []interface{}
+	left   int64
+}
+
+// openParquet opens a parquet file, compressed files are read into memory.
+func openParquet(path string) (source.ParquetFile, *reader.ParquetReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	magic := make([]byte, len(parquetMagic))
+	_, err = io.ReadFull(f, magic)
+	f.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var pf source.ParquetFile
+	if bytes.Equal(magic, parquetMagic) {
+		pf, err = local.NewLocalFileReader(path)
+	} else {
+		var fi io.ReadCloser
+		if fi, err = utils.OpenDecompressed(path); err != nil {
+			return nil, nil, err
+		}
+		var data []byte
+		data, err = ioutil.ReadAll(fi)
+		fi.Close()
+		if err == nil {
+			pf, err = buffer.NewBufferFile(data)
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	pr, err := reader.NewParquetReader(pf, nil, 1)
+	if err != nil {
+		pf.Close()
+		return nil, nil, err
+	}
+	return pf, pr, nil
+}
+
+// parquetHeader returns the header kept in the footer metadata, or nil.
+func parquetHeader(pr *reader.ParquetReader) (*FileHeader, error) {
+	for _, kv := range pr.Footer.GetKeyValueMetadata() {
+		if kv.GetKey() == ParquetHeaderKey {
+			return parseFileHeader(kv.GetValue())
+		}
+	}
+	return nil, nil
+}
+
+func openParquetRows(file *FileRef) (*FileHeader, rowReader, error) {
+	pf, pr, err := openParquet(file.LocalPath)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("file %s: %w", file.ID, err)
+	}
+	header, err := parquetHeader(pr)
+	if err != nil {
+		pr.ReadStop()
+		pf.Close()
+		return nil, nil, xerrors.Errorf("file %s: %w", file.ID, err)
+	}
+	if header == nil {
+		header = &FileHeader{Index: file.Index}
+	}
+
+	names := map[string]string{}
+	for _, info := range pr.SchemaHandler.Infos {
+		names[info.InName] = info.ExName
+	}
+	return header, &parquetRows{file: pf, reader: pr, names: names, left: pr.GetNumRows()}, nil
+}
+
+func (r *parquetRows) Next() (map[string]interface{}, error) {
+	if len(r.rows) == 0 {
+		if r.left <= 0 {
+			return nil, io.EOF
+		}
+		n := int64(parquetReadRows)
+		if n > r.left {
+			n = r.left
+		}
+		rows, err := r.reader.ReadByNumber(int(n))
+		if err != nil {
+			return nil, err
+		}
+		if len(rows) == 0 {
+			return nil, io.EOF
+		}
+		r.rows = rows
+		r.left -= int64(len(rows))
+	}
+	value := reflect.ValueOf(r.rows[0])
+	r.rows = r.rows[1:]
+	for value.Kind() == reflect.Ptr {
+		value = value.Elem()
+	}
+
+	row := map[string]interface{}{}
+	for i := 0; i < value.NumField(); i++ {
+		name, ok := r.names[value.Type().Field(i).Name]
+		if !ok {
+			name = value.Type().Field(i).Name
+		}
+		field := value.Field(i)
+		for field.Kind() == reflect.Ptr && !field.IsNil() {
+			field = field.Elem()
+		}
+		if field.Kind() == reflect.Ptr {
+			row[name] = nil
+			continue
+		}
+		row[name] = field.Interface()
+	}
+	return row, nil
+}
+
+func (r *parquetRows) Close() error {
+	r.reader.ReadStop()
+	return r.file.Close()
+}
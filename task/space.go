@@ -0,0 +1,295 @@
+package task
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/EpiK-Protocol/go-epik-gateway/graph"
+	"github.com/EpiK-Protocol/go-epik-gateway/storage"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+const (
+	AuditCutOver  = "cut-over"
+	AuditRollback = "rollback"
+)
+
+// SpaceVersions maps a space to the nebula space serving it. Shadow rebuilds
+// import into a new version, the replaced ones are kept for rollback.
+type SpaceVersions struct {
+	Space  string `json:"space"`
+	Expert string `json:"expert,omitempty"`
+	Active string `json:"active"`
+	// last version number, the original space is version 1.
+	Version int64 `json:"version"`
+	// replaced nebula spaces from the newest.
+	Kept []string `json:"kept"`
+}
+
+func SpaceVersionsKey(space string) []byte {
+	return []byte("task:replay:version:" + space)
+}
+
+func loadSpaceVersions(st storage.Storage, space string) (*SpaceVersions, error) {
+	bytes, err := st.Get(SpaceVersionsKey(space))
+	if err == storage.ErrKeyNotFound {
+		return &SpaceVersions{Space: space, Active: space, Version: 1, Kept: []string{}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var versions SpaceVersions
+	if err := json.Unmarshal(bytes, &versions); err != nil {
+		return nil, err
+	}
+	return &versions, nil
+}
+
+func (v *SpaceVersions) entry() (storage.Entry, error) {
+	bytes, err := json.Marshal(v)
+	return storage.Entry{Key: SpaceVersionsKey(v.Space), Value: bytes}, err
+}
+
+// shadowSpace returns the nebula space of the next version of space.
+func shadowSpace(versions *SpaceVersions) string {
+	return fmt.Sprintf("%s_v%d", versions.Space, versions.Version+1)
+}
+
+// resolveSpace returns the nebula space serving space.
+func resolveSpace(st storage.Storage, space string) string {
+	versions, err := loadSpaceVersions(st, space)
+	if err != nil {
+		log.Errorf("failed to load space versions of %s:%v", space, err)
+		return space
+	}
+	return versions.Active
+}
+
+// nebulaSpace returns the nebula space expert writes space into, the shadow
+// one while a shadow rebuild of it replays.
+func (t *replayTask) nebulaSpace(expert string, space string) string {
+	t.recordLk.Lock()
+	record := t.records[expert]
+	t.recordLk.Unlock()
+	if record != nil && record.Shadow != "" && record.ShadowOf == space {
+		return record.Shadow
+	}
+	return resolveSpace(t.storage, space)
+}
+
+// nebulaStatements points the CREATE SPACE and USE statements of expert to
+// the nebula spaces.
+func (t *replayTask) nebulaStatements(expert string, stmts []*graph.Statement) {
+	for _, stmt := range stmts {
+		if stmt.Kind == graph.StatementCreateSpace || stmt.Kind == graph.StatementUse {
+			stmt.RenameSpace(t.nebulaSpace(expert, stmt.Space))
+		}
+	}
+}
+
+// ResolveQuery points the USE statements of sql to the nebula spaces, sql
+// is returned unchanged when it can't be parsed.
+func ResolveQuery(sql string, resolve func(space string) string) string {
+	stmts, err := graph.ParseNGQL(sql)
+	if err != nil {
+		return sql
+	}
+	changed := false
+	for _, stmt := range stmts {
+		if stmt.Kind != graph.StatementUse {
+			continue
+		}
+		if space := resolve(stmt.Space); space != stmt.Space {
+			stmt.RenameSpace(space)
+			changed = true
+		}
+	}
+	if !changed {
+		return sql
+	}
+	return graph.Render(stmts)
+}
+
+// caughtUp reports whether all files of record are replayed.
+func caughtUp(record *WriteRecord) bool {
+	for index := range record.History {
+		if index >= record.Index {
+			return false
+		}
+	}
+	return len(record.History) > 0
+}
+
+// shadow starts a shadow rebuild of space, expert replays into a new version
+// until it catches up.
+func (t *replayTask) shadow(expert string, record *WriteRecord, space string) error {
+	versions, err := loadSpaceVersions(t.storage, space)
+	if err != nil {
+		return err
+	}
+	shadow := shadowSpace(versions)
+	if err := t.claimSpace(expert, shadow); err != nil {
+		return err
+	}
+	// a version left by an aborted rebuild.
+	if err := t.dropNebulaSpace(expert, shadow); err != nil {
+		return err
+	}
+	versions.Version++
+	versions.Expert = expert
+	entry, err := versions.entry()
+	if err != nil {
+		return err
+	}
+	if err := t.storage.Write(entry); err != nil {
+		return err
+	}
+	record.Shadow = shadow
+	record.ShadowOf = space
+	return nil
+}
+
+// abandonShadow drops the shadow space of an unfinished shadow rebuild.
+func (t *replayTask) abandonShadow(expert string, record *WriteRecord) error {
+	if record.Shadow == "" {
+		return nil
+	}
+	if err := t.dropNebulaSpace(expert, record.Shadow); err != nil {
+		return err
+	}
+	if err := t.storage.Del(SpaceOwnerKey(record.Shadow)); err != nil {
+		return err
+	}
+	log.WithFields(logrus.Fields{
+		"expert": expert,
+		"space":  record.ShadowOf,
+		"shadow": record.Shadow,
+	}).Warn("abandon shadow nebula space.")
+	record.Shadow = ""
+	record.ShadowOf = ""
+	return t.saveRecord(expert, record)
+}
+
+// cutOver switches the space of a caught up shadow rebuild to the shadow
+// version, versions beyond the kept count are dropped.
+func (t *replayTask) cutOver(expert string, record *WriteRecord) error {
+	versions, err := loadSpaceVersions(t.storage, record.ShadowOf)
+	if err != nil {
+		return err
+	}
+	replaced := versions.Active
+	versions.Active = record.Shadow
+	versions.Kept = append([]string{replaced}, versions.Kept...)
+	dropped := []string{}
+	if keep := t.conf.Replay.KeepVersions; len(versions.Kept) > keep {
+		dropped = versions.Kept[keep:]
+		versions.Kept = versions.Kept[:keep]
+	}
+	reason := fmt.Sprintf("space %s from %s to %s", versions.Space, replaced, versions.Active)
+	if err := audit(t.storage, &AuditEntry{Expert: expert, Action: AuditCutOver, From: record.Index, To: record.Index, Reason: reason}); err != nil {
+		return err
+	}
+
+	record.Shadow = ""
+	record.ShadowOf = ""
+	ventry, err := versions.entry()
+	if err != nil {
+		return err
+	}
+	rbytes, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if err := t.storage.Write(ventry, storage.Entry{Key: RecordKey(expert), Value: rbytes}); err != nil {
+		return err
+	}
+	log.WithFields(logrus.Fields{
+		"expert":   expert,
+		"space":    versions.Space,
+		"active":   versions.Active,
+		"replaced": replaced,
+		"dropped":  dropped,
+	}).Warn("cut over nebula space.")
+
+	for _, space := range dropped {
+		if err := t.dropNebulaSpace(expert, space); err != nil {
+			log.Errorf("failed to drop replaced nebula space %s:%v", space, err)
+			continue
+		}
+		if space != versions.Space {
+			if err := t.storage.Del(SpaceOwnerKey(space)); err != nil {
+				log.Errorf("failed to release nebula space %s:%v", space, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (t *replayTask) Spaces() ([]*SpaceVersions, error) {
+	spaces := []*SpaceVersions{}
+	err := t.storage.Iterate(SpaceVersionsKey(""), func(key []byte, value []byte) error {
+		var versions SpaceVersions
+		if err := json.Unmarshal(value, &versions); err != nil {
+			return err
+		}
+		spaces = append(spaces, &versions)
+		return nil
+	})
+	sort.Slice(spaces, func(i, j int) bool {
+		return spaces[i].Space < spaces[j].Space
+	})
+	return spaces, err
+}
+
+func (t *replayTask) Rollback(space string, to string) (*SpaceVersions, error) {
+	if _, err := t.storage.Get(SpaceVersionsKey(space)); err != nil {
+		return nil, err
+	}
+	versions, err := loadSpaceVersions(t.storage, space)
+	if err != nil {
+		return nil, err
+	}
+	lk := t.expertLock(versions.Expert)
+	lk.Lock()
+	defer lk.Unlock()
+
+	if len(versions.Kept) == 0 {
+		return nil, xerrors.Errorf("space %s has no kept version", space)
+	}
+	if to == "" {
+		to = versions.Kept[0]
+	}
+	kept := []string{versions.Active}
+	found := false
+	for _, version := range versions.Kept {
+		if version == to {
+			found = true
+			continue
+		}
+		kept = append(kept, version)
+	}
+	if !found {
+		return nil, xerrors.Errorf("%s is not a kept version of space %s", to, space)
+	}
+	reason := fmt.Sprintf("space %s from %s to %s", space, versions.Active, to)
+	if err := audit(t.storage, &AuditEntry{Expert: versions.Expert, Action: AuditRollback, Reason: reason}); err != nil {
+		return nil, err
+	}
+	versions.Active = to
+	versions.Kept = kept
+	entry, err := versions.entry()
+	if err != nil {
+		return nil, err
+	}
+	if err := t.storage.Write(entry); err != nil {
+		return nil, err
+	}
+	log.Warnf("roll back %s", reason)
+	return versions, nil
+}
+
+func (t *replayTask) ResolveSpace(space string) string {
+	return resolveSpace(t.storage, space)
+}
@@ -0,0 +1,206 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/EpiK-Protocol/go-epik-gateway/app/config"
+	"golang.org/x/time/rate"
+)
+
+const throttleChunk = 32 * 1024
+
+type transferWindow struct {
+	// offsets from local midnight, equal for all day.
+	start time.Duration
+	end   time.Duration
+}
+
+// parseTransferWindow parses "HH:MM-HH:MM", the end may be 24:00.
+func parseTransferWindow(s string) (transferWindow, error) {
+	var sh, sm, eh, em int
+	if _, err := fmt.Sscanf(s, "%d:%d-%d:%d", &sh, &sm, &eh, &em); err != nil {
+		return transferWindow{}, fmt.Errorf("invalid transfer window %q: %v", s, err)
+	}
+	if sh < 0 || sh > 23 || eh < 0 || eh > 24 || sm < 0 || sm > 59 || em < 0 || em > 59 || (eh == 24 && em != 0) {
+		return transferWindow{}, fmt.Errorf("invalid transfer window %q", s)
+	}
+	return transferWindow{
+		start: time.Duration(sh)*time.Hour + time.Duration(sm)*time.Minute,
+		end:   time.Duration(eh)*time.Hour + time.Duration(em)*time.Minute,
+	}, nil
+}
+
+func (w transferWindow) contains(offset time.Duration) bool {
+	if w.start == w.end%(24*time.Hour) {
+		return true
+	}
+	if w.start < w.end {
+		return offset >= w.start && offset < w.end
+	}
+	// window crosses midnight.
+	return offset >= w.start || offset < w.end
+}
+
+// transferLimiter throttles transfers globally and per source, and keeps
+// heavy transfers inside the configured time windows.
+type transferLimiter struct {
+	conf    config.Transfer
+	windows []transferWindow
+
+	global *rate.Limiter
+
+	lk      sync.Mutex
+	sources map[string]*rate.Limiter
+}
+
+func newTransferLimiter(conf config.Transfer) (*transferLimiter, error) {
+	l := &transferLimiter{
+		conf:    conf,
+		sources: make(map[string]*rate.Limiter),
+	}
+	for _, s := range conf.Windows {
+		w, err := parseTransferWindow(s)
+		if err != nil {
+			return nil, err
+		}
+		l.windows = append(l.windows, w)
+	}
+	if conf.RateLimit > 0 {
+		l.global = rate.NewLimiter(rate.Limit(conf.RateLimit), throttleChunk)
+	}
+	return l, nil
+}
+
+// inWindow reports whether heavy transfers are allowed at now.
+func (l *transferLimiter) inWindow(now time.Time) bool {
+	if len(l.windows) == 0 {
+		return true
+	}
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	offset := now.Sub(midnight)
+	for _, w := range l.windows {
+		if w.contains(offset) {
+			return true
+		}
+	}
+	return false
+}
+
+// waitWindow blocks until heavy transfers are allowed.
+func (l *transferLimiter) waitWindow(ctx context.Context) error {
+	paused := false
+	for !l.inWindow(time.Now()) {
+		if !paused {
+			paused = true
+			log.Info("outside transfer window, pause transfer.")
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Minute):
+		}
+	}
+	if paused {
+		log.Info("inside transfer window, resume transfer.")
+	}
+	return nil
+}
+
+// sourceHost returns the bare host name of source, limits are keyed by it.
+func sourceHost(source string) string {
+	if host, _, err := net.SplitHostPort(source); err == nil {
+		return host
+	}
+	return source
+}
+
+func (l *transferLimiter) limiters(source string) []*rate.Limiter {
+	source = sourceHost(source)
+	limiters := []*rate.Limiter{}
+	if l.global != nil {
+		limiters = append(limiters, l.global)
+	}
+	limit, ok := l.conf.SourceRateLimit[source]
+	if !ok || limit <= 0 {
+		return limiters
+	}
+
+	l.lk.Lock()
+	defer l.lk.Unlock()
+	limiter, ok := l.sources[source]
+	if !ok {
+		limiter = rate.NewLimiter(rate.Limit(limit), throttleChunk)
+		l.sources[source] = limiter
+	}
+	return append(limiters, limiter)
+}
+
+// timeout estimates how long a transfer of size bytes from source may take,
+// a day of pauses outside the windows included. Returns zero when the source
+// is neither throttled nor paused.
+func (l *transferLimiter) timeout(source string, size int64) time.Duration {
+	var slowest rate.Limit
+	for _, limiter := range l.limiters(source) {
+		if slowest == 0 || limiter.Limit() < slowest {
+			slowest = limiter.Limit()
+		}
+	}
+	timeout := time.Duration(0)
+	if slowest > 0 {
+		timeout = time.Duration(float64(size)/float64(slowest)*2)*time.Second + 10*time.Minute
+	}
+	if len(l.windows) > 0 {
+		if timeout == 0 {
+			timeout = 10 * time.Minute
+		}
+		timeout += 24 * time.Hour
+	}
+	return timeout
+}
+
+// Reader throttles r by the limits of source. With pause set, reading also
+// blocks while outside the transfer windows.
+func (l *transferLimiter) Reader(ctx context.Context, source string, r io.Reader, pause bool) io.Reader {
+	limiters := l.limiters(source)
+	if len(limiters) == 0 && (!pause || len(l.windows) == 0) {
+		return r
+	}
+	return &throttledReader{
+		ctx:      ctx,
+		r:        r,
+		limiter:  l,
+		limiters: limiters,
+		pause:    pause,
+	}
+}
+
+type throttledReader struct {
+	ctx      context.Context
+	r        io.Reader
+	limiter  *transferLimiter
+	limiters []*rate.Limiter
+	pause    bool
+}
+
+func (r *throttledReader) Read(p []byte) (int, error) {
+	if r.pause {
+		if err := r.limiter.waitWindow(r.ctx); err != nil {
+			return 0, err
+		}
+	}
+	if len(p) > throttleChunk {
+		p = p[:throttleChunk]
+	}
+	n, err := r.r.Read(p)
+	for _, limiter := range r.limiters {
+		if werr := limiter.WaitN(r.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,74 @@
+package task
+
+import (
+	"testing"
+	"time"
+
+	"github.com/EpiK-Protocol/go-epik-gateway/app/config"
+)
+
+func TestParseTransferWindow(t *testing.T) {
+	tests := []struct {
+		window string
+		valid  bool
+		in     []time.Duration
+		out    []time.Duration
+	}{
+		{"08:00-18:30", true, []time.Duration{8 * time.Hour, 18*time.Hour + 29*time.Minute}, []time.Duration{7 * time.Hour, 18*time.Hour + 30*time.Minute}},
+		{"22:00-06:00", true, []time.Duration{23 * time.Hour, 0, 5 * time.Hour}, []time.Duration{6 * time.Hour, 12 * time.Hour}},
+		{"00:00-23:59", true, []time.Duration{0, 23 * time.Hour}, nil},
+		{"22:00-24:00", true, []time.Duration{22 * time.Hour, 24*time.Hour - time.Minute}, []time.Duration{0, 21 * time.Hour}},
+		{"00:00-24:00", true, []time.Duration{0, 12 * time.Hour, 24*time.Hour - time.Minute}, nil},
+		{"00:00-00:00", true, []time.Duration{0, 12 * time.Hour, 24*time.Hour - time.Minute}, nil},
+		{"06:00-06:00", true, []time.Duration{0, 6 * time.Hour, 12 * time.Hour}, nil},
+		{"22:00-24:30", false, nil, nil},
+		{"24:00-06:00", false, nil, nil},
+		{"24:30-06:00", false, nil, nil},
+		{"10:60-11:00", false, nil, nil},
+		{"-1:00-11:00", false, nil, nil},
+		{"10:00", false, nil, nil},
+	}
+	for _, tt := range tests {
+		w, err := parseTransferWindow(tt.window)
+		if (err == nil) != tt.valid {
+			t.Fatalf("%s: %v", tt.window, err)
+		}
+		for _, offset := range tt.in {
+			if !w.contains(offset) {
+				t.Errorf("%s: %s not in window", tt.window, offset)
+			}
+		}
+		for _, offset := range tt.out {
+			if w.contains(offset) {
+				t.Errorf("%s: %s in window", tt.window, offset)
+			}
+		}
+	}
+}
+
+func TestTransferSources(t *testing.T) {
+	l, err := newTransferLimiter(config.Transfer{SourceRateLimit: map[string]int64{"node": 4 * throttleChunk}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// hosts with and without port share the limits.
+	a, b := l.limiters("node"), l.limiters("node:8080")
+	if len(a) != 1 || len(b) != 1 || a[0] != b[0] {
+		t.Errorf("limiters %v %v", a, b)
+	}
+	if len(l.limiters("other")) != 0 {
+		t.Error("unlimited source throttled")
+	}
+	if l.timeout("node", 100*throttleChunk) >= 24*time.Hour || l.timeout("other", 1) != 0 {
+		t.Error("timeout without windows")
+	}
+
+	l, err = newTransferLimiter(config.Transfer{Windows: []string{"22:00-06:00"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a paused transfer may wait a day for the next window.
+	if l.timeout("other", 1) <= 24*time.Hour {
+		t.Errorf("timeout %s", l.timeout("other", 1))
+	}
+}
@@ -0,0 +1,266 @@
+package task
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/EpiK-Protocol/go-epik-gateway/app/config"
+	"github.com/EpiK-Protocol/go-epik-gateway/graph"
+	"golang.org/x/xerrors"
+)
+
+const (
+	VIDHashMD5    = "md5"
+	VIDHashSHA1   = "sha1"
+	VIDHashSHA256 = "sha256"
+)
+
+// TransformContext is the source of the statements of a line.
+type TransformContext struct {
+	Expert  string
+	File    string
+	RootCID string
+	// file index of the expert.
+	Index int64
+	Line  int64
+	Space string
+}
+
+// Transform rewrites the statements of a line before the replay writes them,
+// statements may be edited by their methods, dropped or added.
+type Transform interface {
+	Transform(ctx *TransformContext, stmts []*graph.Statement) ([]*graph.Statement, error)
+}
+
+// TransformFunc adapts a function to Transform.
+type TransformFunc func(ctx *TransformContext, stmts []*graph.Statement) ([]*graph.Statement, error)
+
+func (f TransformFunc) Transform(ctx *TransformContext, stmts []*graph.Statement) ([]*graph.Statement, error) {
+	return f(ctx, stmts)
+}
+
+var (
+	transformsLk sync.RWMutex
+	transforms   = map[string]Transform{}
+)
+
+// RegisterTransform makes a custom transform available to the custom list of
+// the expert transforms, it is usually called from init.
+func RegisterTransform(name string, t Transform) {
+	transformsLk.Lock()
+	defer transformsLk.Unlock()
+	transforms[name] = t
+}
+
+func lookupTransform(name string) (Transform, bool) {
+	transformsLk.RLock()
+	defer transformsLk.RUnlock()
+	t, ok := transforms[name]
+	return t, ok
+}
+
+func validateTransform(conf config.Transform) error {
+	switch conf.VID.Hash {
+	case "", VIDHashMD5, VIDHashSHA1, VIDHashSHA256:
+	default:
+		return xerrors.Errorf("unknown vid hash: %q", conf.VID.Hash)
+	}
+	for prop, source := range conf.Provenance {
+		switch source {
+		case config.ProvenanceExpert, config.ProvenanceFile, config.ProvenanceRootCID, config.ProvenanceIndex:
+		default:
+			return xerrors.Errorf("provenance %s has unknown source: %q", prop, source)
+		}
+	}
+	if err := validateRenames(conf.RenameProps); err != nil {
+		return err
+	}
+	for _, name := range conf.Custom {
+		if _, ok := lookupTransform(name); !ok {
+			return xerrors.Errorf("custom transform %s is not registered", name)
+		}
+	}
+	return nil
+}
+
+// validateRenames rejects property renames applying to the same schema with
+// the same target, or the same source in one scope. A rename of "tag.prop"
+// overrides the one of "prop".
+func validateRenames(renames map[string]string) error {
+	keys := sortedKeys(renames)
+	for i, a := range keys {
+		scopeA, fromA := splitProp(a)
+		for _, b := range keys[i+1:] {
+			scopeB, fromB := splitProp(b)
+			if scopeA != "" && scopeB != "" && scopeA != scopeB {
+				continue
+			}
+			if fromA == fromB && scopeA == scopeB {
+				return xerrors.Errorf("renames %s and %s overlap", a, b)
+			}
+			if renames[a] == renames[b] && fromA != fromB {
+				return xerrors.Errorf("renames %s and %s collide on %s", a, b, renames[a])
+			}
+		}
+	}
+	return nil
+}
+
+// expertTransforms returns the rules and custom transforms of expert, nil
+// without any.
+func expertTransforms(conf config.Config, expert string) ([]Transform, error) {
+	tconf, ok := conf.Replay.Transforms[expert]
+	if !ok {
+		return nil, nil
+	}
+	if err := validateTransform(tconf); err != nil {
+		return nil, xerrors.Errorf("expert %s transform: %w", expert, err)
+	}
+	result := []Transform{ruleTransform{conf: tconf}}
+	for _, name := range tconf.Custom {
+		t, _ := lookupTransform(name)
+		result = append(result, t)
+	}
+	return result, nil
+}
+
+func newTransformContext(file *FileRef, space string) *TransformContext {
+	ctx := &TransformContext{Expert: file.Expert, File: file.ID, Index: file.Index, Space: space}
+	if file.RootCID.Defined() {
+		ctx.RootCID = file.RootCID.String()
+	}
+	return ctx
+}
+
+func applyTransforms(transforms []Transform, ctx *TransformContext, stmts []*graph.Statement) ([]*graph.Statement, error) {
+	var err error
+	for _, t := range transforms {
+		if stmts, err = t.Transform(ctx, stmts); err != nil {
+			return nil, err
+		}
+	}
+	return stmts, nil
+}
+
+// ruleTransform applies the configured rules of an expert.
+type ruleTransform struct {
+	conf config.Transform
+}
+
+// splitProp splits "schema.prop", the schema is empty for all.
+func splitProp(prop string) (string, string) {
+	if i := strings.LastIndex(prop, "."); i >= 0 {
+		return prop[:i], prop[i+1:]
+	}
+	return "", prop
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (r ruleTransform) Transform(ctx *TransformContext, stmts []*graph.Statement) ([]*graph.Statement, error) {
+	for _, stmt := range stmts {
+		schema := stmt.Schema()
+		if schema == "" {
+			continue
+		}
+		names := append([]string{}, stmt.Names()...)
+		for _, name := range names {
+			for _, drop := range r.conf.DropProps {
+				if target, prop := splitProp(drop); target == "" || target == name {
+					stmt.DropProp(schema, name, prop)
+				}
+			}
+			renames := map[string]string{}
+			for from, to := range r.conf.RenameProps {
+				if target, prop := splitProp(from); target == "" {
+					if _, ok := renames[prop]; !ok {
+						renames[prop] = to
+					}
+				} else if target == name {
+					renames[prop] = to
+				}
+			}
+			stmt.RenameProps(schema, name, renames)
+			if prop := duplicate(stmt.Props[name]); prop != "" {
+				return nil, xerrors.Errorf("%s %s has property %s twice after renames", schema, name, prop)
+			}
+		}
+
+		renames := r.conf.RenameTags
+		if schema == graph.SchemaEdge {
+			renames = r.conf.RenameEdges
+		}
+		for i, name := range names {
+			if to, ok := renames[name]; ok && stmt.RenameSchema(schema, name, to) {
+				names[i] = to
+			}
+		}
+		if r.conf.VID.Hash != "" || r.conf.VID.Prefix != "" {
+			stmt.MapVIDs(r.vid)
+		}
+		for _, prop := range sortedKeys(r.conf.Provenance) {
+			def, value := provenance(ctx, r.conf.Provenance[prop])
+			for _, name := range names {
+				stmt.AddProp(schema, name, prop, def, value)
+			}
+		}
+	}
+	return stmts, nil
+}
+
+func duplicate(names []string) string {
+	seen := map[string]bool{}
+	for _, name := range names {
+		if seen[name] {
+			return name
+		}
+		seen[name] = true
+	}
+	return ""
+}
+
+// vid hashes and prefixes a string vid literal, other expressions are kept.
+func (r ruleTransform) vid(expr string) string {
+	vid, ok := graph.StringLiteral(strings.TrimSpace(expr))
+	if !ok {
+		return expr
+	}
+	switch r.conf.VID.Hash {
+	case VIDHashMD5:
+		sum := md5.Sum([]byte(vid))
+		vid = hex.EncodeToString(sum[:])
+	case VIDHashSHA1:
+		sum := sha1.Sum([]byte(vid))
+		vid = hex.EncodeToString(sum[:])
+	case VIDHashSHA256:
+		sum := sha256.Sum256([]byte(vid))
+		vid = hex.EncodeToString(sum[:])
+	}
+	return quoteString(r.conf.VID.Prefix + vid)
+}
+
+// provenance returns the property type and value literal of source.
+func provenance(ctx *TransformContext, source string) (string, string) {
+	switch source {
+	case config.ProvenanceFile:
+		return "string", quoteString(ctx.File)
+	case config.ProvenanceRootCID:
+		return "string", quoteString(ctx.RootCID)
+	case config.ProvenanceIndex:
+		return "int64", strconv.FormatInt(ctx.Index, 10)
+	}
+	return "string", quoteString(ctx.Expert)
+}
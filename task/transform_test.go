@@ -0,0 +1,80 @@
+package task
+
+import (
+	"testing"
+
+	"github.com/EpiK-Protocol/go-epik-gateway/app/config"
+	"github.com/EpiK-Protocol/go-epik-gateway/graph"
+)
+
+func TestRuleTransform(t *testing.T) {
+	tests := []struct {
+		conf config.Transform
+		sql  string
+		want string
+	}{
+		{config.Transform{RenameProps: map[string]string{"age": "name", "name": "title"}},
+			`CREATE TAG person(name string, age int);INSERT VERTEX person(name, age) VALUES "a":("A", 1)`,
+			`CREATE TAG person(title string, name int);INSERT VERTEX person(title, name) VALUES "a":("A", 1);`},
+		// a rename of the tag overrides the one of every tag.
+		{config.Transform{RenameProps: map[string]string{"person.name": "title", "name": "label"}},
+			`INSERT VERTEX person(name), city(name) VALUES "a":("A", "C")`,
+			`INSERT VERTEX person(title), city(label) VALUES "a":("A", "C");`},
+		{config.Transform{DropProps: []string{"rel.name", "phone"}, RenameTags: map[string]string{"entity": "node"}, RenameEdges: map[string]string{"rel": "link"}},
+			`INSERT VERTEX entity(value, phone) VALUES "a":("A", "1");INSERT EDGE rel(name, w) VALUES "a"->"b":("x", 1)`,
+			`INSERT VERTEX node(value) VALUES "a":("A");INSERT EDGE link(w) VALUES "a"->"b":(1);`},
+		{config.Transform{VID: config.VIDTransform{Hash: VIDHashMD5, Prefix: "x_"}},
+			`INSERT EDGE e(w) VALUES "a"->hash("b"):(1);UPSERT VERTEX ON t "a" SET v = 1 WHEN v > 0`,
+			`INSERT EDGE e(w) VALUES "x_0cc175b9c0f1b6a831c399e269772661"->hash("b"):(1);UPSERT VERTEX ON t "x_0cc175b9c0f1b6a831c399e269772661" SET v = 1 WHEN v > 0;`},
+		{config.Transform{Provenance: map[string]string{"src": config.ProvenanceExpert, "idx": config.ProvenanceIndex}},
+			`CREATE TAG t(v string);INSERT VERTEX t(v) VALUES "a":("A");CREATE TAG INDEX i ON t(v(8));USE sp`,
+			`CREATE TAG t(v string, idx int64, src string);INSERT VERTEX t(v, idx, src) VALUES "a":("A", 3, "ex");CREATE TAG INDEX i ON t(v(8));USE sp;`},
+	}
+	ctx := &TransformContext{Expert: "ex", File: "f", Index: 3}
+	for _, tt := range tests {
+		if err := validateTransform(tt.conf); err != nil {
+			t.Fatal(err)
+		}
+		stmts, err := ruleTransform{conf: tt.conf}.Transform(ctx, parseNGQL(t, tt.sql))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := graph.Render(stmts); got != tt.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", tt.sql, got, tt.want)
+		}
+	}
+}
+
+func TestRuleTransformCollision(t *testing.T) {
+	conf := config.Transform{RenameProps: map[string]string{"age": "name"}}
+	_, err := ruleTransform{conf: conf}.Transform(&TransformContext{}, parseNGQL(t, "CREATE TAG p(name string, age int)"))
+	if err == nil {
+		t.Error("renamed onto an existing property")
+	}
+}
+
+func TestValidateTransform(t *testing.T) {
+	RegisterTransform("test", TransformFunc(func(ctx *TransformContext, stmts []*graph.Statement) ([]*graph.Statement, error) {
+		return stmts, nil
+	}))
+	tests := []struct {
+		conf  config.Transform
+		valid bool
+	}{
+		{config.Transform{RenameProps: map[string]string{"age": "name", "name": "title"}}, true},
+		{config.Transform{RenameProps: map[string]string{"a.x": "y", "b.z": "y"}}, true},
+		{config.Transform{RenameProps: map[string]string{"x": "y", "z": "y"}}, false},
+		{config.Transform{RenameProps: map[string]string{"a.x": "y", "z": "y"}}, false},
+		{config.Transform{RenameProps: map[string]string{"a.x": "y", "x": "z"}}, true},
+		{config.Transform{RenameProps: map[string]string{"a.x": "y", "x": "y"}}, true},
+		{config.Transform{VID: config.VIDTransform{Hash: "crc32"}}, false},
+		{config.Transform{Provenance: map[string]string{"src": "host"}}, false},
+		{config.Transform{Custom: []string{"test"}}, true},
+		{config.Transform{Custom: []string{"missing"}}, false},
+	}
+	for i, tt := range tests {
+		if err := validateTransform(tt.conf); (err == nil) != tt.valid {
+			t.Errorf("%d: %v", i, err)
+		}
+	}
+}
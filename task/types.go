@@ -8,6 +8,7 @@ import (
 	"io"
 	"os"
 
+	"github.com/EpiK-Protocol/go-epik-gateway/utils"
 	"github.com/ipfs/go-cid"
 )
 
@@ -40,6 +41,11 @@ const (
 const (
 	FileEventNeedDownload = "file:download"
 	FileEventDownloaded   = "file:downloaded"
+	FileEventImported     = "file:imported"
+	FileEventReplayed     = "file:replayed"
+
+	// published with the expert once its last known file is replayed.
+	ExpertEventCaughtUp = "expert:caught-up"
 )
 
 // Taskinterface
@@ -49,6 +55,9 @@ type Task interface {
 
 	// Stop tasks
 	Stop(context.Context) error
+
+	// Replayer returns the replay controls.
+	Replayer() Replayer
 }
 
 type FileRef struct {
@@ -105,6 +114,21 @@ func getFileMd5(path string) (string, error) {
 	return hex.EncodeToString(md5h.Sum(nil)), nil
 }
 
+// getDecompressedMd5 returns the md5 of a file compressed by the gateway
+// before compression.
+func getDecompressedMd5(path string) (string, error) {
+	r, err := utils.OpenDecompressed(path)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	md5h := md5.New()
+	if _, err := io.Copy(md5h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(md5h.Sum(nil)), nil
+}
+
 type ResponseCode struct {
 	Code    int64
 	Message string
@@ -0,0 +1,437 @@
+package task
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/EpiK-Protocol/go-epik-gateway/app/config"
+	"github.com/EpiK-Protocol/go-epik-gateway/graph"
+	"github.com/EpiK-Protocol/go-epik-gateway/storage"
+	"github.com/EpiK-Protocol/go-epik-gateway/utils"
+	"golang.org/x/xerrors"
+)
+
+// issues kept in a report, later ones are only counted.
+const maxValidateIssues = 1000
+
+// ValidateReport is the result of running an expert file through the replay
+// parsing and checks without writing anything.
+type ValidateReport struct {
+	Expert string      `json:"expert"`
+	File   string      `json:"file"`
+	Header *FileHeader `json:"header,omitempty"`
+	Space  string      `json:"space"`
+	// lines after the header.
+	Lines int64 `json:"lines"`
+	// parsed statements by kind, rejected ones included.
+	Statements map[string]int64 `json:"statements"`
+	Rejected   int64            `json:"rejected"`
+	Valid      bool             `json:"valid"`
+
+	ErrorCount   int64            `json:"error_count"`
+	WarningCount int64            `json:"warning_count"`
+	Errors       []*ValidateIssue `json:"errors"`
+	Warnings     []*ValidateIssue `json:"warnings"`
+	// nGQL the replay would execute by line.
+	NGQL []*ValidateLine `json:"ngql,omitempty"`
+}
+
+// ValidateIssue is a problem of a file line, line 0 is about the file.
+type ValidateIssue struct {
+	Line    int64  `json:"line"`
+	Message string `json:"message"`
+}
+
+type ValidateLine struct {
+	Line int64  `json:"line"`
+	NGQL string `json:"ngql"`
+}
+
+// ValidateOptions are the replay state a file is validated against.
+type ValidateOptions struct {
+	// space assigned to the expert by earlier files.
+	Space string
+	// schema of the space before the file, it is extended by the file.
+	Schema *graph.Schema
+	// keep the generated nGQL in the report.
+	NGQL bool
+}
+
+func (r *ValidateReport) addError(line int64, format string, args ...interface{}) {
+	r.Valid = false
+	r.ErrorCount++
+	if len(r.Errors) < maxValidateIssues {
+		r.Errors = append(r.Errors, &ValidateIssue{Line: line, Message: fmt.Sprintf(format, args...)})
+	}
+}
+
+func (r *ValidateReport) addWarning(line int64, format string, args ...interface{}) {
+	r.WarningCount++
+	if len(r.Warnings) < maxValidateIssues {
+		r.Warnings = append(r.Warnings, &ValidateIssue{Line: line, Message: fmt.Sprintf(format, args...)})
+	}
+}
+
+type fileValidator struct {
+	conf   config.Config
+	report *ValidateReport
+	schema *graph.Schema
+	ngql   bool
+	// transforms of the expert and the source of the current line.
+	transforms []Transform
+	tctx       *TransformContext
+	// the missing space is reported once.
+	spaceless bool
+}
+
+// ValidateFile checks the header, statements, replay policy and schema of an
+// expert file the way the replay reads it. Only failing to read the file is
+// returned as error, the problems of the file are in the report.
+func ValidateFile(conf config.Config, file *FileRef, opts ValidateOptions) (*ValidateReport, error) {
+	if _, err := os.Stat(file.LocalPath); err != nil {
+		return nil, err
+	}
+	report := &ValidateReport{
+		Expert:     file.Expert,
+		File:       file.ID,
+		Space:      opts.Space,
+		Statements: map[string]int64{},
+		Valid:      true,
+		Errors:     []*ValidateIssue{},
+		Warnings:   []*ValidateIssue{},
+	}
+	if assigned := conf.Server.ExpertSpaces[file.Expert]; assigned != "" {
+		report.Space = assigned
+	}
+	if opts.Schema == nil {
+		opts.Schema = graph.NewSchema()
+	}
+	v := &fileValidator{conf: conf, report: report, schema: opts.Schema, ngql: opts.NGQL}
+
+	header, err := validateFile(file)
+	if err != nil {
+		report.addError(1, "%v", err)
+		return report, nil
+	}
+	report.Header = header
+	if report.Space == "" {
+		report.Space = header.Domain
+	}
+	if header.Domain != "" && header.Domain != report.Space {
+		report.addError(1, "domain %s is not the expert space %s", header.Domain, report.Space)
+	}
+	if v.transforms, err = expertTransforms(conf, file.Expert); err != nil {
+		report.addError(0, "%v", err)
+		return report, nil
+	}
+	v.tctx = newTransformContext(file, report.Space)
+	if v.tctx.Index == 0 {
+		v.tctx.Index = header.Index
+	}
+
+	if mapping, ok := conf.Replay.Mappings[file.Expert]; ok {
+		err = v.validateRows(file, mapping)
+	} else {
+		err = v.validateLines(file)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func (v *fileValidator) validateLines(file *FileRef) error {
+	osfile, err := utils.OpenDecompressed(file.LocalPath)
+	if err != nil {
+		return err
+	}
+	defer osfile.Close()
+	scanner := bufio.NewScanner(osfile)
+	scanner.Buffer([]byte{}, bufio.MaxScanTokenSize*100)
+	line := int64(0)
+	for scanner.Scan() {
+		line++
+		if line == 1 {
+			continue
+		}
+		v.report.Lines++
+		stmts, err := graph.ParseNGQL(scanner.Text())
+		if err != nil {
+			v.report.addError(line, "failed to parse: %v", err)
+			continue
+		}
+		v.statements(line, stmts, true)
+	}
+	return scanner.Err()
+}
+
+func (v *fileValidator) validateRows(file *FileRef, mapping config.Mapping) error {
+	if err := validateMapping(mapping); err != nil {
+		v.report.addError(0, "expert %s mapping: %v", file.Expert, err)
+		return nil
+	}
+	_, rows, err := openRows(file, mapping)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	line := int64(1)
+	if mapping.CreateSchema {
+		stmts, err := graph.ParseNGQL(mappingSchema(mapping))
+		if err != nil {
+			return err
+		}
+		v.statements(line, stmts, false)
+	}
+	for {
+		row, err := rows.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			v.report.addError(line+1, "failed to read: %v", err)
+			break
+		}
+		line++
+		v.report.Lines++
+		sql, err := mappingStatements(mapping, row)
+		if err != nil {
+			v.report.addError(line, "failed to map: %v", err)
+			continue
+		}
+		if sql == "" {
+			continue
+		}
+		stmts, err := graph.ParseNGQL(sql)
+		if err != nil {
+			v.report.addError(line, "failed to parse: %v", err)
+			continue
+		}
+		v.statements(line, stmts, false)
+	}
+	return nil
+}
+
+// statements checks the statements of a line, the replay policy applies to
+// the statements of nGQL files only. The schema is checked after the expert
+// transforms, the way the replay writes them.
+func (v *fileValidator) statements(line int64, stmts []*graph.Statement, policy bool) {
+	if len(stmts) == 0 {
+		return
+	}
+	if v.report.Space == "" {
+		v.report.Space = createdSpace(stmts)
+	}
+	allowed := []*graph.Statement{}
+	for _, stmt := range stmts {
+		v.report.Statements[string(stmt.Kind)]++
+		if policy {
+			if err := checkStatement(v.report.Space, stmt); err != nil {
+				v.report.Rejected++
+				if v.conf.Replay.Strict {
+					v.report.addError(line, "%v", err)
+				} else {
+					v.report.addWarning(line, "%v", err)
+				}
+				continue
+			}
+		}
+		for _, name := range stmt.Unquoted() {
+			v.report.addWarning(line, "name %s is quoted by backticks", name)
+		}
+		allowed = append(allowed, stmt)
+	}
+	v.tctx.Line, v.tctx.Space = line, v.report.Space
+	allowed, err := applyTransforms(v.transforms, v.tctx, allowed)
+	if err != nil {
+		v.report.addError(line, "failed to transform: %v", err)
+		return
+	}
+	for _, stmt := range allowed {
+		if err := v.checkSchema(stmt); err != nil {
+			v.report.addError(line, "%v", err)
+		}
+	}
+	if len(allowed) == 0 {
+		return
+	}
+	if v.report.Space == "" && !v.spaceless {
+		v.spaceless = true
+		v.report.addError(line, "failed to find domain of expert %s", v.report.Expert)
+	}
+	if v.ngql {
+		v.report.NGQL = append(v.report.NGQL, &ValidateLine{Line: line, NGQL: graph.Render(allowed)})
+	}
+}
+
+// checkSchema checks the tags, edges and properties written by stmt exist and
+// the literal values fit their types, created schemas are added.
+func (v *fileValidator) checkSchema(stmt *graph.Statement) error {
+	switch stmt.Kind {
+	case graph.StatementCreateTag, graph.StatementCreateEdge:
+		v.schema.Apply(stmt)
+	case graph.StatementCreateTagIndex, graph.StatementCreateEdgeIndex:
+		schema := graph.SchemaTag
+		if stmt.Kind == graph.StatementCreateEdgeIndex {
+			schema = graph.SchemaEdge
+		}
+		if _, err := v.propTypes(schema, stmt.Name, stmt.Props[stmt.Name]); err != nil {
+			return err
+		}
+		v.schema.Apply(stmt)
+	case graph.StatementInsertVertex, graph.StatementUpsertVertex:
+		types := []string{}
+		for _, tag := range stmt.Tags {
+			tagTypes, err := v.propTypes(graph.SchemaTag, tag, stmt.Props[tag])
+			if err != nil {
+				return err
+			}
+			types = append(types, tagTypes...)
+		}
+		return checkValues(stmt, types)
+	case graph.StatementInsertEdge, graph.StatementUpsertEdge:
+		types, err := v.propTypes(graph.SchemaEdge, stmt.Name, stmt.Props[stmt.Name])
+		if err != nil {
+			return err
+		}
+		return checkValues(stmt, types)
+	}
+	return nil
+}
+
+// propTypes returns the types of props of a tag or edge.
+func (v *fileValidator) propTypes(schema string, name string, props []string) ([]string, error) {
+	schemas := v.schema.Tags
+	if schema == graph.SchemaEdge {
+		schemas = v.schema.Edges
+	}
+	defined, ok := schemas[name]
+	if !ok {
+		return nil, xerrors.Errorf("%s %s is not created", schema, name)
+	}
+	types := make([]string, 0, len(props))
+	for _, prop := range props {
+		typ, found := "", false
+		for _, p := range defined {
+			if p.Name == prop {
+				typ, found = p.Type, true
+				break
+			}
+		}
+		if !found {
+			return nil, xerrors.Errorf("%s %s has no property %s", schema, name, prop)
+		}
+		types = append(types, typ)
+	}
+	return types, nil
+}
+
+func checkValues(stmt *graph.Statement, types []string) error {
+	for _, row := range stmt.Rows {
+		if len(row.Values) != len(types) {
+			return xerrors.Errorf("%d values for %d properties", len(row.Values), len(types))
+		}
+		for i, value := range row.Values {
+			if typ := literalType(value); !assignable(types[i], typ) {
+				return xerrors.Errorf("%s value %s for a %s property", typ, value, types[i])
+			}
+		}
+	}
+	return nil
+}
+
+// literalType returns the type of a literal, empty for other expressions.
+func literalType(expr string) string {
+	expr = strings.TrimSpace(expr)
+	switch graph.Literal(expr).(type) {
+	case nil:
+		return "null"
+	case int64:
+		return PropInt
+	case float64:
+		return PropDouble
+	case bool:
+		return PropBool
+	case string:
+		if strings.HasPrefix(expr, `"`) || strings.HasPrefix(expr, "'") {
+			return PropString
+		}
+	}
+	return ""
+}
+
+// assignable reports whether a literal of typ can be written to a property of
+// the nebula type prop, unknown types are not checked.
+func assignable(prop string, typ string) bool {
+	prop = graph.NormalizeType(prop)
+	switch {
+	case typ == "" || typ == "null" || prop == "":
+		return true
+	case strings.HasPrefix(prop, "int"):
+		return typ == PropInt
+	case prop == "double" || prop == "float":
+		return typ == PropInt || typ == PropDouble
+	case prop == "bool":
+		return typ == PropBool
+	case prop == "string" || strings.HasPrefix(prop, "fixed_string"):
+		return typ == PropString
+	case prop == "timestamp":
+		return typ == PropInt || typ == PropString
+	}
+	return true
+}
+
+// Validate checks a file of expert against the space and registered schema
+// the replay would import it into.
+func (t *replayTask) Validate(expert string, name string, data io.Reader, ngql bool) (*ValidateReport, error) {
+	tmp, err := os.CreateTemp("", "epik-validate-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	opts := ValidateOptions{NGQL: ngql}
+	record, err := t.loadRecord(expert)
+	if err == nil {
+		opts.Space = record.Space
+	} else if err != storage.ErrKeyNotFound {
+		return nil, err
+	}
+	space := t.conf.Server.ExpertSpaces[expert]
+	if space == "" {
+		space = opts.Space
+	}
+	if space != "" {
+		schema, err := loadSpaceSchema(t.storage, space)
+		if err == nil {
+			opts.Schema = schema.Schema
+		} else if err != storage.ErrKeyNotFound {
+			return nil, err
+		}
+	}
+
+	report, err := ValidateFile(t.conf, &FileRef{ID: name, Expert: expert, LocalPath: tmp.Name()}, opts)
+	if err != nil {
+		return nil, err
+	}
+	if space == "" && report.Space != "" {
+		owner, err := t.storage.Get(SpaceOwnerKey(report.Space))
+		if err == nil && string(owner) != expert {
+			report.addError(1, "space %s is owned by expert %s", report.Space, owner)
+		} else if err != nil && err != storage.ErrKeyNotFound {
+			return nil, err
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,160 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	CodecNone = ""
+	CodecGzip = "gzip"
+	CodecZstd = "zstd"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// CodecExt returns the file extension of codec.
+func CodecExt(codec string) string {
+	switch codec {
+	case CodecGzip:
+		return ".gz"
+	case CodecZstd:
+		return ".zst"
+	}
+	return ""
+}
+
+type decompressReader struct {
+	io.Reader
+	closers []func() error
+}
+
+func (r *decompressReader) Close() error {
+	var err error
+	for i := len(r.closers) - 1; i >= 0; i-- {
+		if cerr := r.closers[i](); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// OpenDecompressed opens file at path, transparently decompressing
+// gzip or zstd content detected by its magic bytes.
+func OpenDecompressed(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := newDecompressReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	r.closers = append([]func() error{f.Close}, r.closers...)
+	return r, nil
+}
+
+// NewDecompressReader wraps r, transparently decompressing gzip or zstd
+// content detected by its magic bytes.
+func NewDecompressReader(r io.Reader) (io.ReadCloser, error) {
+	return newDecompressReader(r)
+}
+
+// detectCodec returns the codec of content starting with magic.
+func detectCodec(magic []byte) string {
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return CodecGzip
+	case bytes.HasPrefix(magic, zstdMagic):
+		return CodecZstd
+	}
+	return CodecNone
+}
+
+// FileCodec returns the codec of the content of file at path, detected by
+// its magic bytes.
+func FileCodec(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return CodecNone, err
+	}
+	defer f.Close()
+	magic := make([]byte, len(zstdMagic))
+	n, err := io.ReadFull(f, magic)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return CodecNone, err
+	}
+	return detectCodec(magic[:n]), nil
+}
+
+func newDecompressReader(r io.Reader) (*decompressReader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	switch detectCodec(magic) {
+	case CodecGzip:
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return &decompressReader{Reader: gr, closers: []func() error{gr.Close}}, nil
+	case CodecZstd:
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return &decompressReader{Reader: zr, closers: []func() error{func() error {
+			zr.Close()
+			return nil
+		}}}, nil
+	}
+	return &decompressReader{Reader: br}, nil
+}
+
+// CompressFile compresses src into dst with codec.
+func CompressFile(src, dst, codec string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	var writer io.WriteCloser
+	switch codec {
+	case CodecGzip:
+		writer = gzip.NewWriter(out)
+	case CodecZstd:
+		zw, err := zstd.NewWriter(out)
+		if err != nil {
+			return err
+		}
+		writer = zw
+	default:
+		return fmt.Errorf("unknown compression codec:%s", codec)
+	}
+	if _, err := io.Copy(writer, in); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return out.Sync()
+}
@@ -0,0 +1,16 @@
+package utils
+
+import (
+	"errors"
+	"os"
+)
+
+// DiskFree returns bytes available to unprivileged users on the filesystem of path.
+func DiskFree(path string) (uint64, error) {
+	return 0, errors.New("disk free space is not supported on windows")
+}
+
+// fileKey is not supported on windows, every file counts as one link.
+func fileKey(info os.FileInfo) (inode, uint64, bool) {
+	return inode{}, 1, false
+}
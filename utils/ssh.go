@@ -20,6 +20,9 @@ type SSHConfig struct {
 	UserName       string
 	Password       string
 	PrivateKeyPath string
+
+	// scp transfer timeout, zero uses the scp default.
+	Timeout time.Duration
 }
 
 type SSHClient struct {
@@ -74,6 +77,12 @@ func SCPFile(conf SSHConfig, srcFile string, destFile string) error {
 }
 
 func SCPFileFromRemote(conf SSHConfig, srcFile string, destFile string) error {
+	return SCPFileFromRemotePassThru(conf, srcFile, destFile, nil)
+}
+
+// SCPFileFromRemotePassThru copies remote srcFile to destFile, the remote
+// stream is wrapped by passThru when it is not nil.
+func SCPFileFromRemotePassThru(conf SSHConfig, srcFile string, destFile string, passThru scp.PassThru) error {
 	s := NewSSH(conf)
 	if s.client == nil {
 		if err := s.connect(); err != nil {
@@ -81,7 +90,13 @@ func SCPFileFromRemote(conf SSHConfig, srcFile string, destFile string) error {
 		}
 	}
 
-	client, err := scp.NewClientBySSH(s.client)
+	var client scp.Client
+	var err error
+	if conf.Timeout > 0 {
+		client, err = scp.NewClientBySSHWithTimeout(s.client, conf.Timeout)
+	} else {
+		client, err = scp.NewClientBySSH(s.client)
+	}
 	if err != nil {
 		return err
 	}
@@ -100,7 +115,7 @@ func SCPFileFromRemote(conf SSHConfig, srcFile string, destFile string) error {
 
 	// Finaly, copy the file over
 	// Usage: CopyFile(fileReader, remotePath, permission)
-	err = client.CopyFromRemote(f, srcFile)
+	err = client.CopyFromRemotePassThru(f, srcFile, passThru)
 	if err != nil {
 		return err
 	}
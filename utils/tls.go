@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+
+	"golang.org/x/xerrors"
+)
+
+// TLSConfig builds a client tls config, caFile is added to the system roots
+// and certFile with keyFile is the client certificate, all in pem.
+func TLSConfig(caFile, certFile, keyFile string, insecureSkipVerify bool) (*tls.Config, error) {
+	tlsConf := &tls.Config{
+		InsecureSkipVerify: insecureSkipVerify,
+	}
+	if len(caFile) > 0 {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, xerrors.Errorf("no certificate found in ca file:%s", caFile)
+		}
+		tlsConf.RootCAs = pool
+	}
+	if len(certFile) > 0 || len(keyFile) > 0 {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConf.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConf, nil
+}
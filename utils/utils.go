@@ -11,11 +11,13 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"math"
 	"math/rand"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strconv"
 	"time"
@@ -200,3 +202,62 @@ func Exists(name string) (bool, error) {
 	}
 	return false, err
 }
+
+type inode struct {
+	dev uint64
+	ino uint64
+}
+
+// DirSize returns the total size of regular files under dir, hard links of
+// a file are counted once.
+func DirSize(dir string) (int64, error) {
+	size := int64(0)
+	seen := map[inode]bool{}
+	err := filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		if key, links, ok := fileKey(info); ok && links > 1 {
+			if seen[key] {
+				return nil
+			}
+			seen[key] = true
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
+
+// FileLinks returns the hard link count of the file of info, 1 when unknown.
+func FileLinks(info os.FileInfo) uint64 {
+	_, links, _ := fileKey(info)
+	return links
+}
+
+// CopyFile copies src to dst, a partial dst is removed on failure.
+func CopyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(dst)
+	}
+	return err
+}